@@ -0,0 +1,9 @@
+// Package prompts embeds the prompt definitions of this directory, which are the builtin prompts of a curation run.
+package prompts
+
+import "embed"
+
+// Builtin holds the yaml prompt definitions, used when the configured prompt directory doesn't define them.
+//
+//go:embed *.yaml
+var Builtin embed.FS
@@ -0,0 +1,309 @@
+package curate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"ozzysoft.net/wordle/pkg/llama"
+	"strings"
+	"time"
+)
+
+// BatchConfig puts Size words to the model per chat request.
+type BatchConfig struct {
+	Size   int           `yaml:"size"`
+	Linger time.Duration `yaml:"linger"`
+}
+
+func DefaultBatchConfig() BatchConfig {
+	return BatchConfig{Size: 1, Linger: 100 * time.Millisecond}
+}
+
+// BatchClassifier decides several words with a single chat request, splitting failed answers.
+type BatchClassifier struct {
+	backend llama.Backend
+	options DetermineOptions
+	retry   RetryPolicy
+	single  *SingleClassifier
+	stages  []Stage
+	stats   *RunStats
+}
+
+// NewBatchClassifier runs the stages on each word first, only the words they leave undecided go to the model.
+func NewBatchClassifier(backend llama.Backend, options DetermineOptions, retry RetryPolicy, stages []Stage, stats *RunStats) *BatchClassifier {
+	return &BatchClassifier{
+		backend: backend,
+		options: options,
+		retry:   retry,
+		single:  NewSingleClassifier(backend, options, retry),
+		stages:  stages,
+		stats:   stats,
+	}
+}
+
+// ClassifyBatch returns the determinations for words, in the same order.
+func (c *BatchClassifier) ClassifyBatch(ctx context.Context, words []string) []Determination {
+	unique := make([]string, 0, len(words))
+	seen := make(map[string]bool, len(words))
+	for _, word := range words {
+		if !seen[word] {
+			seen[word] = true
+			unique = append(unique, word)
+		}
+	}
+
+	determinations := make(map[string]Determination, len(unique))
+	tags := make(map[string][]Tag)
+	undecided := make([]string, 0, len(unique))
+	for _, word := range unique {
+		wordTags, decided := inspectStages(ctx, c.stages, c.stats, word)
+		if decided != nil {
+			determinations[word] = *decided
+			continue
+		}
+		tags[word] = wordTags
+		undecided = append(undecided, word)
+	}
+
+	if len(undecided) > 0 {
+		c.classify(ctx, undecided, determinations)
+	}
+	for word, wordTags := range tags {
+		determination := determinations[word]
+		determination.Tags = append(wordTags, determination.Tags...)
+		determinations[word] = determination
+	}
+
+	result := make([]Determination, len(words))
+	for i, word := range words {
+		result[i] = determinations[word]
+	}
+	return result
+}
+
+func (c *BatchClassifier) classify(ctx context.Context, words []string, determinations map[string]Determination) {
+	logger := getLogger()
+
+	if len(words) == 1 {
+		determinations[words[0]] = c.single.Classify(ctx, words[0])
+		return
+	}
+
+	c.stats.recordBatch()
+	answered, failed := c.ask(ctx, words)
+	if failed.DeadLetter {
+		// the model couldn't be reached, each word is dead lettered on its own for a retry
+		for _, word := range words {
+			determinations[word] = failed.forWord()
+		}
+		return
+	}
+
+	var missing []string
+	for _, word := range words {
+		if determination, found := answered[word]; found {
+			determinations[word] = determination
+		} else {
+			missing = append(missing, word)
+		}
+	}
+
+	if len(missing) == 0 {
+		return
+	}
+
+	c.stats.recordBatchRetry()
+	if len(missing) == len(words) {
+		logger.Warnf("batch of words (%d) came back malformed or failed, splitting it", len(words))
+		half := len(words) / 2
+		c.classify(ctx, words[:half], determinations)
+		c.classify(ctx, words[half:], determinations)
+		return
+	}
+
+	logger.Infof("batch of words (%d) came back partial, retrying missing words (%d)", len(words), len(missing))
+	c.classify(ctx, missing, determinations)
+}
+
+// ask puts the words to the model once, with retries for transient failures.
+func (c *BatchClassifier) ask(ctx context.Context, words []string) (map[string]Determination, Determination) {
+	logger := getLogger()
+
+	definition := c.options.prompt()
+	base := Determination{
+		Decision:      DecisionUndetermined,
+		Reason:        ReasonEmpty,
+		Model:         c.options.model(),
+		PromptVersion: definition.Version,
+		BatchSize:     len(words),
+	}
+
+	prompt, err := definition.renderBatch(words)
+	if err != nil {
+		logger.Warnf("batch of words (%d), %s", len(words), err)
+		base.Reason = ReasonUnparseable
+		base.Err = err
+		return nil, base
+	}
+	base.Prompt = prompt
+
+	options := c.options.promptOptions()
+	if c.options.MaxTokens > 0 {
+		// the cap is per word
+		options["num_predict"] = c.options.MaxTokens * len(words)
+	}
+
+	var messages []llama.ChatMessage
+	if definition.System != "" {
+		messages = append(messages, llama.ChatMessage{Role: "system", Content: definition.System})
+	}
+	request := llama.ChatRequest{
+		Model:    base.Model,
+		Messages: append(messages, llama.ChatMessage{Role: "user", Content: prompt}),
+		Subject:  strings.Join(words, ","),
+		Template: definition.Version,
+		Format:   batchSchema(words),
+		Options:  options,
+	}
+
+	var response llama.ChatResponse
+	result := determineWithRetry(ctx, c.retry, request.Subject, func(ctx context.Context) Determination {
+		determination := base
+		resp, err := c.backend.Chat(ctx, request)
+		if err != nil {
+			logger.Infof("failed to chat %s response for batch of words (%d).  (%s)", c.backend.Name(), len(words), err)
+			determination.Reason = reasonForError(err)
+			determination.Err = err
+			return determination
+		}
+		response = resp
+		return determination
+	})
+	if result.Err != nil {
+		return nil, result
+	}
+
+	base.Attempts = result.Attempts
+	base.Metrics = shareMetrics(response.Metrics, len(words))
+	if response.Model != "" {
+		base.Model = response.Model
+	}
+
+	answers, err := parseBatchVerdicts(response.Message.Content, words)
+	if err != nil {
+		logger.Debugf("failed to parse batch verdicts (%s).  (%s)", response.Message.Content, err)
+	}
+
+	determinations := make(map[string]Determination, len(answers))
+	for word, answer := range answers {
+		determination := base
+		determination.Response = answer.response
+		determination.Verdict, determination.Decision, determination.Reason = verdictDecision(answer.verdict, c.options.MinConfidence)
+		determinations[word] = determination
+	}
+	return determinations, base
+}
+
+// forWord returns a failed batch determination for one of its words, without the batch prompt and size.
+func (d Determination) forWord() Determination {
+	d.Prompt = ""
+	d.BatchSize = 0
+	return d
+}
+
+// batchSchema is the verdict schema as an array with one item per word, the word itself restricted to the batch.
+func batchSchema(words []string) json.RawMessage {
+	quoted, _ := json.Marshal(words)
+	return json.RawMessage(fmt.Sprintf(`{
+  "type": "object",
+  "properties": {
+    "verdicts": {
+      "type": "array",
+      "minItems": %d,
+      "maxItems": %d,
+      "items": {
+        "type": "object",
+        "properties": {
+          "word": {"type": "string", "enum": %s},
+          "obscure": {"type": "boolean"},
+          "confidence": {"type": "number", "minimum": 0, "maximum": 1},
+          "reasons": {"type": "array", "items": {"type": "string", "enum": [%s]}},
+          "definition": {"type": "string"}
+        },
+        "required": ["word", "obscure", "confidence", "reasons", "definition"]
+      }
+    }
+  },
+  "required": ["verdicts"]
+}`, len(words), len(words), quoted, quotedReasonCodes()))
+}
+
+type batchAnswer struct {
+	verdict  Verdict
+	response string
+}
+
+// parseBatchVerdicts returns the valid verdicts of the words in the batch that were answered exactly once.
+func parseBatchVerdicts(response string, words []string) (map[string]batchAnswer, error) {
+	var raw struct {
+		Verdicts []map[string]json.RawMessage `json:"verdicts"`
+	}
+	if err := json.Unmarshal([]byte(response), &raw); err != nil {
+		return nil, fmt.Errorf("invalid batch json. %w", err)
+	}
+	if len(raw.Verdicts) == 0 {
+		return nil, errors.New("batch has no verdicts")
+	}
+
+	inBatch := make(map[string]bool, len(words))
+	for _, word := range words {
+		inBatch[word] = true
+	}
+
+	counts := make(map[string]int)
+	answers := make(map[string]batchAnswer)
+	for _, item := range raw.Verdicts {
+		var word string
+		if err := json.Unmarshal(item["word"], &word); err != nil {
+			continue
+		}
+		word = strings.ToLower(strings.TrimSpace(word))
+		counts[word]++
+
+		delete(item, "word")
+		b, err := json.Marshal(item)
+		if err != nil {
+			continue
+		}
+		verdict, err := parseJSONVerdict(string(b))
+		if err != nil {
+			continue
+		}
+		answers[word] = batchAnswer{verdict: verdict, response: string(b)}
+	}
+
+	for word := range answers {
+		if !inBatch[word] || counts[word] != 1 {
+			delete(answers, word)
+		}
+	}
+	return answers, nil
+}
+
+// shareMetrics splits the metrics of a batch evenly over its words.
+func shareMetrics(m llama.Metrics, n int) llama.Metrics {
+	if n <= 1 {
+		return m
+	}
+
+	count := time.Duration(n)
+	return llama.Metrics{
+		TotalDuration:      m.TotalDuration / count,
+		LoadDuration:       m.LoadDuration / count,
+		PromptEvalCount:    m.PromptEvalCount / n,
+		PromptEvalDuration: m.PromptEvalDuration / count,
+		EvalCount:          m.EvalCount / n,
+		EvalDuration:       m.EvalDuration / count,
+	}
+}
@@ -0,0 +1,55 @@
+package curate
+
+import (
+	"context"
+	"errors"
+	"io"
+	"ozzysoft.net/wordle/pkg/llama"
+	"testing"
+)
+
+// chatFailingBackend fails every chat request with err, generate requests are answered.
+type chatFailingBackend struct {
+	*llama.FakeBackend
+	err error
+}
+
+func (b *chatFailingBackend) Chat(ctx context.Context, request llama.ChatRequest) (llama.ChatResponse, error) {
+	return llama.ChatResponse{}, b.err
+}
+
+func TestBatchFailure(t *testing.T) {
+	prompts, err := LoadPrompts(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := DefaultDetermineOptions()
+	if err := options.resolvePrompt(prompts); err != nil {
+		t.Fatal(err)
+	}
+	retry := DefaultRetryPolicy()
+	retry.MaxAttempts = 1
+
+	words := []string{"abbey", "aahed", "cable"}
+	respond := func(request llama.GenerateRequest) string {
+		return `{"obscure": false, "confidence": 0.9, "reasons": [], "definition": "a word"}`
+	}
+
+	// an unreachable model dead letters each word on its own
+	backend := &chatFailingBackend{FakeBackend: llama.NewFakeBackend(respond), err: io.ErrUnexpectedEOF}
+	determinations := NewBatchClassifier(backend, options, retry, nil, &RunStats{}).ClassifyBatch(context.Background(), words)
+	for i, determination := range determinations {
+		if !determination.DeadLetter || determination.BatchSize != 0 || determination.Prompt != "" {
+			t.Errorf("word (%s) has dead letter (%t), batch size (%d), prompt (%s)", words[i], determination.DeadLetter, determination.BatchSize, determination.Prompt)
+		}
+	}
+
+	// any other failure splits the batch down to single words
+	backend = &chatFailingBackend{FakeBackend: llama.NewFakeBackend(respond), err: errors.New("context window exceeded")}
+	determinations = NewBatchClassifier(backend, options, retry, nil, &RunStats{}).ClassifyBatch(context.Background(), words)
+	for i, determination := range determinations {
+		if determination.Decision != DecisionKeep || determination.Err != nil {
+			t.Errorf("word (%s) has decision (%s), error (%v), expected it decided on its own", words[i], determination.Decision, determination.Err)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package curate
+
+import (
+	"context"
+	"ozzysoft.net/wordle/pkg/llama"
+	"sync"
+)
+
+const (
+	tierFast   = "fast"
+	tierStrong = "strong"
+)
+
+// TierConfig is one tier of a cascade, a model (or ensemble) with its own concurrency limit.
+type TierConfig struct {
+	MaxConcurrency int              `yaml:"maxConcurrency"`
+	Determine      DetermineOptions `yaml:"determine"`
+	Ensemble       EnsembleConfig   `yaml:"ensemble"`
+}
+
+// CascadeConfig runs every word through the fast tier and escalates only the words it is unsure of to the strong tier.
+type CascadeConfig struct {
+	Enabled bool       `yaml:"enabled"`
+	Fast    TierConfig `yaml:"fast"`
+	Strong  TierConfig `yaml:"strong"`
+	// MinConfidence escalates fast tier verdicts below this confidence.
+	MinConfidence float64 `yaml:"minConfidence"`
+}
+
+// limiter returns the tier's limiter, an adaptive one is capped at the tier's MaxConcurrency.
+func (t TierConfig) limiter(concurrency ConcurrencyConfig) Limiter {
+	concurrency.Max = min(concurrency.Max, t.MaxConcurrency)
+	return NewLimiter(t.MaxConcurrency, concurrency)
+}
+
+func DefaultCascadeConfig() CascadeConfig {
+	strong := DefaultDetermineOptions()
+	strong.Model = "llama3.1:70b"
+
+	return CascadeConfig{
+		Enabled:       false,
+		Fast:          TierConfig{MaxConcurrency: 10, Determine: DefaultDetermineOptions()},
+		Strong:        TierConfig{MaxConcurrency: 2, Determine: strong},
+		MinConfidence: 0.8,
+	}
+}
+
+// Escalation records the fast tier answer for a word that was sent on to the strong tier.
+type Escalation struct {
+	Reason     string   `json:"reason"`
+	Decision   Decision `json:"decision"`
+	Confidence *float64 `json:"confidence,omitempty"`
+	Model      string   `json:"model"`
+	Response   string   `json:"response"`
+	LatencyMs  float64  `json:"latency_ms"`
+
+	// tags are the fast tier stage tags, carried over to the strong tier result
+	tags []Tag
+}
+
+// escalationReason returns why a fast tier result needs the strong tier, or an empty string when it doesn't.
+func escalationReason(result CurateResult, minConfidence float64) string {
+	switch {
+	case result.deadLetter:
+		return ""
+	case result.decision == DecisionUndetermined:
+		return "undetermined:" + string(result.reason)
+	case isDisagreement(result.votes):
+		return "inconsistent"
+	case result.verdict != nil && result.verdict.Confidence < minConfidence:
+		return "low_confidence"
+	default:
+		return ""
+	}
+}
+
+// startCascade sends the words through the fast WordWorker and escalates doubtful ones to the strong one.
+func startCascade(ctx context.Context, backend llama.Backend, config Config, stages []Stage, stats *RunStats, wordChannel <-chan string, resultChannel chan<- CurateResult) (*WordWorker, error) {
+	cascade := config.Cascade
+
+	fastClassifier, err := NewClassifier(backend, cascade.Fast.Determine, cascade.Fast.Ensemble, config.Retry)
+	if err != nil {
+		return nil, err
+	}
+	strongClassifier, err := NewClassifier(backend, cascade.Strong.Determine, cascade.Strong.Ensemble, config.Retry)
+	if err != nil {
+		return nil, err
+	}
+
+	fastResults := make(chan CurateResult, 100)
+	strongWords := make(chan string, 100)
+	strongResults := make(chan CurateResult, 100)
+
+	fast := NewWordWorker(cascade.Fast.limiter(config.Concurrency), wordChannel, fastResults, NewStagedClassifier(stages, fastClassifier, stats))
+	strong := NewWordWorker(cascade.Strong.limiter(config.Concurrency), strongWords, strongResults, strongClassifier)
+
+	escalations := sync.Map{}
+	routeFast := func() {
+		defer close(strongWords)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case result := <-fastResults:
+				if result.done {
+					return
+				}
+
+				result.tier = tierFast
+				stats.recordTier(tierFast, result.latency)
+				reason := escalationReason(result, cascade.MinConfidence)
+				if reason == "" {
+					select {
+					case <-ctx.Done():
+						return
+					case resultChannel <- result:
+					}
+					continue
+				}
+
+				stats.recordEscalation()
+				escalations.Store(result.word, newEscalation(result, reason))
+				select {
+				case <-ctx.Done():
+					return
+				case strongWords <- result.word:
+				}
+			}
+		}
+	}
+
+	forwardStrong := func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case result := <-strongResults:
+				if !result.done {
+					result.tier = tierStrong
+					stats.recordTier(tierStrong, result.latency)
+					if escalation, found := escalations.LoadAndDelete(result.word); found {
+						result.escalation = escalation.(*Escalation)
+						result.tags = append(result.escalation.tags, result.tags...)
+					}
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case resultChannel <- result:
+				}
+				if result.done {
+					return
+				}
+			}
+		}
+	}
+
+	getLogger().Infof("starting cascade, fast concurrency (%d), strong concurrency (%d), adaptive concurrency (%t), escalation min confidence (%f)",
+		cascade.Fast.MaxConcurrency, cascade.Strong.MaxConcurrency, config.Concurrency.Adaptive, cascade.MinConfidence)
+	go routeFast()
+	go forwardStrong()
+	go fast.processWordChannel(ctx)
+	go strong.processWordChannel(ctx)
+
+	return fast, nil
+}
+
+func newEscalation(result CurateResult, reason string) *Escalation {
+	escalation := &Escalation{
+		Reason:    reason,
+		Decision:  result.decision,
+		Model:     result.model,
+		Response:  result.response,
+		LatencyMs: milliseconds(result.latency),
+		tags:      result.tags,
+	}
+	if result.verdict != nil {
+		confidence := result.verdict.Confidence
+		escalation.Confidence = &confidence
+	}
+	return escalation
+}
@@ -0,0 +1,37 @@
+package curate
+
+import (
+	"context"
+	"ozzysoft.net/wordle/pkg/llama"
+)
+
+// Classifier decides a single word.  WordWorker runs a Classifier for every word it reads.
+type Classifier interface {
+	Classify(ctx context.Context, word string) Determination
+}
+
+// SingleClassifier asks one model once per word, retrying transient failures.
+type SingleClassifier struct {
+	backend llama.Backend
+	options DetermineOptions
+	retry   RetryPolicy
+}
+
+func NewSingleClassifier(backend llama.Backend, options DetermineOptions, retry RetryPolicy) *SingleClassifier {
+	return &SingleClassifier{backend: backend, options: options, retry: retry}
+}
+
+func (c *SingleClassifier) Classify(ctx context.Context, word string) Determination {
+	return determineWithRetry(ctx, c.retry, word, func(ctx context.Context) Determination {
+		return IsWordRareOrObscure(ctx, c.backend, word, c.options)
+	})
+}
+
+// NewClassifier builds a single model classifier, or an ensemble when voters are configured.
+func NewClassifier(backend llama.Backend, options DetermineOptions, ensemble EnsembleConfig, retry RetryPolicy) (Classifier, error) {
+	if len(ensemble.Voters) == 0 {
+		return NewSingleClassifier(backend, options, retry), nil
+	}
+
+	return NewEnsembleClassifier(backend, ensemble, options, retry)
+}
@@ -2,39 +2,48 @@ package curate
 
 import (
 	"context"
-	ollama "github.com/ollama/ollama/api"
+	"sync"
 	"sync/atomic"
 	"time"
 )
 
 type WordWorker struct {
-	maxConcurrency  int
+	limiter         Limiter
 	wordChannel     <-chan string
 	resultChannel   chan<- CurateResult
-	client          *ollama.Client
+	classifier      Classifier
 	reportFrequency int32
-	verbose         bool
 
-	concurrentChannel chan interface{}
-	readComplete      atomic.Bool
-	inProcess         atomic.Int32
+	// batches of words are classified together when batcher is set
+	batcher *BatchClassifier
+	batch   BatchConfig
+
+	readComplete atomic.Bool
+	inProcess    atomic.Int32
+	terminalOnce sync.Once
 
 	startTime    time.Time
 	processCount atomic.Int32
 }
 
-func NewWordWorker(maxConcurrency int, wordChannel <-chan string, resultChannel chan<- CurateResult, client *ollama.Client, verbose bool) *WordWorker {
+func NewWordWorker(limiter Limiter, wordChannel <-chan string, resultChannel chan<- CurateResult, classifier Classifier) *WordWorker {
 	return &WordWorker{
-		maxConcurrency:    maxConcurrency,
-		wordChannel:       wordChannel,
-		resultChannel:     resultChannel,
-		client:            client,
-		reportFrequency:   100,
-		verbose:           verbose,
-		concurrentChannel: setupConcurrentChannel(maxConcurrency),
+		limiter:         limiter,
+		wordChannel:     wordChannel,
+		resultChannel:   resultChannel,
+		classifier:      classifier,
+		reportFrequency: 100,
 	}
 }
 
+// NewBatchWordWorker classifies the words in batches of up to batch.Size, a batch takes one limiter slot.
+func NewBatchWordWorker(limiter Limiter, wordChannel <-chan string, resultChannel chan<- CurateResult, batcher *BatchClassifier, batch BatchConfig) *WordWorker {
+	w := NewWordWorker(limiter, wordChannel, resultChannel, batcher.single)
+	w.batcher = batcher
+	w.batch = batch
+	return w
+}
+
 func (w *WordWorker) isComplete() bool {
 	return w.readComplete.Load() && w.inProcess.Load() <= 0
 }
@@ -55,14 +64,29 @@ func (w *WordWorker) incrementProcessCount() {
 	v := w.processCount.Add(1)
 	if v%w.reportFrequency == 0 {
 		elapsed := time.Since(w.startTime)
-		getLogger().Infof("words processed (%d), elapsed (%s), average milliseconds (%f)", v, elapsed, float64(elapsed.Milliseconds())/float64(v))
+		increases, decreases := w.limiter.Adjustments()
+		getLogger().Infof("words processed (%d), elapsed (%s), average milliseconds (%f), concurrency limit (%d), in process (%d), limit raised (%d), limit lowered (%d)",
+			v, elapsed, float64(elapsed.Milliseconds())/float64(v), w.limiter.Limit(), w.inProcess.Load(), increases, decreases)
 	}
 }
 
-func (w *WordWorker) sendTerminalMessageToResultProcesserIfNecessary() {
+func (w *WordWorker) sendTerminalMessageToResultProcesserIfNecessary(ctx context.Context) {
 	if w.isComplete() {
-		w.resultChannel <- NewTerminalCurateResult()
-		getLogger().Warnf("terminal result message sent")
+		w.terminalOnce.Do(func() {
+			if w.sendResult(ctx, NewTerminalCurateResult()) {
+				getLogger().Warnf("terminal result message sent")
+			}
+		})
+	}
+}
+
+// sendResult gives up once the context is cancelled, the consumer may have stopped reading.
+func (w *WordWorker) sendResult(ctx context.Context, result CurateResult) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case w.resultChannel <- result:
+		return true
 	}
 }
 
@@ -73,75 +97,123 @@ func (w *WordWorker) processWordChannel(ctx context.Context) bool {
 	logger.Infof("starting word processing")
 	w.startTime = time.Now()
 
+	// words waiting for their batch to fill, sent when it's full or the linger expires
+	var pending []string
+	var linger <-chan time.Time
+
 	for {
 		select {
 		case <-ctx.Done():
 			w.markReadComplete()
 			return false
+		case <-linger:
+			w.processBatch(ctx, pending)
+			pending, linger = nil, nil
 		case word, open := <-w.wordChannel:
 			if !open {
 				logger.Infof("word channel closed")
+				if len(pending) > 0 {
+					w.processBatch(ctx, pending)
+				}
 				w.markReadComplete()
-				// handle cleanup
+				// every word may already be curated (or none were sent), so check for completion here as well
+				w.sendTerminalMessageToResultProcesserIfNecessary(ctx)
 				return true
 			} else {
 				//logger.Debugf("word from channel (%s)", word)
 				w.incrementInProcess()
-				w.processWord(ctx, word)
+				if w.batcher == nil {
+					w.processWord(ctx, word)
+					continue
+				}
+
+				pending = append(pending, word)
+				if len(pending) == 1 {
+					linger = time.After(w.batch.Linger)
+				}
+				if len(pending) >= w.batch.Size {
+					w.processBatch(ctx, pending)
+					pending, linger = nil, nil
+				}
 			}
 		}
 	}
-
-	return true
 }
 
 func (w *WordWorker) processWord(ctx context.Context, word string) bool {
-	select {
-	case <-ctx.Done():
+	if !w.limiter.Acquire(ctx) {
 		w.markReadComplete()
 		w.decrementInProcess()
 		return false
-	case token := <-w.concurrentChannel:
-		go w.curateWord(ctx, token, word)
-		return true
 	}
 
-	return false
+	go w.curateWord(ctx, word)
+	return true
 }
 
-func (w *WordWorker) curateWord(ctx context.Context, token interface{}, word string) bool {
-	logger := getLogger()
+func (w *WordWorker) processBatch(ctx context.Context, words []string) bool {
+	if !w.limiter.Acquire(ctx) {
+		w.markReadComplete()
+		for range words {
+			w.decrementInProcess()
+		}
+		return false
+	}
+
+	go w.curateBatch(ctx, words)
+	return true
+}
 
-	writeTokenToChannel := func() {
-		w.concurrentChannel <- token
+// curateBatch sends a result for every word of the batch, each with the batch latency shared evenly.
+func (w *WordWorker) curateBatch(ctx context.Context, words []string) {
+	start := time.Now()
+	determinations := w.batcher.ClassifyBatch(ctx, words)
+	elapsed := time.Since(start)
+
+	failed := false
+	for _, determination := range determinations {
+		failed = failed || determination.Err != nil || determination.Attempts > 1
+	}
+	w.limiter.Release(elapsed, failed)
+
+	latency := elapsed / time.Duration(len(words))
+	for i, word := range words {
+		if !w.sendResult(ctx, NewCurateResult(word, determinations[i], latency)) {
+			return
+		}
+		w.incrementProcessCount()
+		w.decrementInProcess()
 	}
-	defer writeTokenToChannel()
+	w.sendTerminalMessageToResultProcesserIfNecessary(ctx)
+}
+
+func (w *WordWorker) curateWord(ctx context.Context, word string) Decision {
+	logger := getLogger()
 
 	start := time.Now()
-	rareOrObscure, response := IsWordRareOrObscure(ctx, w.client, word, w.verbose)
+	determination := w.classifier.Classify(ctx, word)
 	elapsed := time.Since(start)
+
+	// failures and retried words tell an adaptive limiter the server is struggling, words decided without the model
+	// (no attempts) tell it nothing
+	failed := determination.Err != nil || determination.Attempts > 1
+	if determination.Attempts == 0 {
+		defer w.limiter.Release(0, failed)
+	} else {
+		defer w.limiter.Release(elapsed, failed)
+	}
 	if false {
-		logger.Debugf("word (%s), is rare or obscure (%t), elapsed (%s)", word, rareOrObscure, elapsed)
+		logger.Debugf("word (%s), decision (%s), elapsed (%s)", word, determination.Decision, elapsed)
 	}
 
-	result := NewCurateResult(word, rareOrObscure, response)
-	w.resultChannel <- result
+	result := NewCurateResult(word, determination, elapsed)
+	if !w.sendResult(ctx, result) {
+		return determination.Decision
+	}
 
 	w.incrementProcessCount()
 	w.decrementInProcess()
-	w.sendTerminalMessageToResultProcesserIfNecessary()
+	w.sendTerminalMessageToResultProcesserIfNecessary(ctx)
 
-	return rareOrObscure
-}
-
-func setupConcurrentChannel(size int) chan interface{} {
-	c := make(chan interface{}, size)
-	populateChan(c, size)
-	return c
-}
-
-func populateChan(c chan<- interface{}, size int) {
-	for i := range size {
-		c <- i
-	}
+	return determination.Decision
 }
@@ -0,0 +1,123 @@
+package curate
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"ozzysoft.net/wordle/pkg/llama"
+)
+
+// Config holds the settings for a curation run.
+type Config struct {
+	InputPath            string `yaml:"inputPath"`
+	CuratedPath          string `yaml:"curatedPath"`
+	CuratedResponsePath  string `yaml:"curatedResponsePath"`
+	ExcludedPath         string `yaml:"excludedPath"`
+	ExcludedResponsePath string `yaml:"excludedResponsePath"`
+	// UndeterminedPath lists words with no decision, for retry or review.
+	UndeterminedPath         string `yaml:"undeterminedPath"`
+	UndeterminedResponsePath string `yaml:"undeterminedResponsePath"`
+	// GuessOnlyPath lists words overridden as valid guesses that are never answers.
+	GuessOnlyPath         string `yaml:"guessOnlyPath"`
+	GuessOnlyResponsePath string `yaml:"guessOnlyResponsePath"`
+	JournalPath           string `yaml:"journalPath"`
+	ResultsPath           string `yaml:"resultsPath"`
+	// RunsDir holds a directory per run with its manifest and a copy of its results, see WriteRun.
+	RunsDir string `yaml:"runsDir"`
+	// DeadLetterPath lists words that exhausted their retries, see ReprocessDeadLetters.
+	DeadLetterPath string `yaml:"deadLetterPath"`
+	// SensitivePath lists the words the sensitive stage tagged, for a person to confirm.
+	SensitivePath         string `yaml:"sensitivePath"`
+	SensitiveResponsePath string `yaml:"sensitiveResponsePath"`
+
+	// LegacyOutput also writes the curated/excluded word and response text files alongside the structured results.
+	LegacyOutput bool `yaml:"legacyOutput"`
+	// PromptDir holds the yaml prompt definitions the determine prompt is picked from.
+	PromptDir string `yaml:"promptDir"`
+
+	Backend        llama.BackendConfig `yaml:"backend"`
+	ProcessMax     int                 `yaml:"processMax"`
+	MaxConcurrency int                 `yaml:"maxConcurrency"`
+	// Concurrency replaces the fixed MaxConcurrency with an adaptive limit when enabled.
+	Concurrency ConcurrencyConfig `yaml:"concurrency"`
+	Determine   DetermineOptions  `yaml:"determine"`
+	Retry       RetryPolicy       `yaml:"retry"`
+	// Ensemble replaces the single Determine model with voters when any are configured.
+	Ensemble EnsembleConfig `yaml:"ensemble"`
+	// Overrides are decisions made by people, taking precedence over the model and the stages.
+	Overrides OverridesConfig `yaml:"overrides"`
+	// Stages run ahead of the model and may decide a word without it.
+	Stages StagesConfig `yaml:"stages"`
+	// Batch puts several words to the Determine model per request when its size is above one.
+	Batch BatchConfig `yaml:"batch"`
+	// Cascade replaces Determine and Ensemble with a fast and a strong tier when enabled.
+	Cascade CascadeConfig `yaml:"cascade"`
+	// Review picks the words the review command puts to a person.
+	Review ReviewConfig `yaml:"review"`
+	// Sweep is the grid of the sweep command.
+	Sweep SweepConfig `yaml:"sweep"`
+	// Consistency checks the explanations of the responses against their verdicts.
+	Consistency ConsistencyConfig `yaml:"consistency"`
+
+	// Fresh discards any existing journal and truncates the outputs instead of resuming.
+	Fresh bool `yaml:"-"`
+	// Append keeps existing outputs even when there is no journal to resume from.
+	Append bool `yaml:"-"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		InputPath:                "data/words_five.txt",
+		CuratedPath:              "data/curated.txt",
+		CuratedResponsePath:      "data/curated.response.txt",
+		ExcludedPath:             "data/excluded.txt",
+		ExcludedResponsePath:     "data/excluded.response.txt",
+		UndeterminedPath:         "data/undetermined.txt",
+		UndeterminedResponsePath: "data/undetermined.response.txt",
+		GuessOnlyPath:            "data/guess-only.txt",
+		GuessOnlyResponsePath:    "data/guess-only.response.txt",
+		JournalPath:              "data/curate.journal",
+		ResultsPath:              "data/results.jsonl",
+		RunsDir:                  "data/runs",
+		DeadLetterPath:           "data/deadletter.txt",
+		SensitivePath:            "data/sensitive.txt",
+		SensitiveResponsePath:    "data/sensitive.response.txt",
+		LegacyOutput:             true,
+		PromptDir:                "config/prompts",
+		Backend:                  llama.DefaultBackendConfig(),
+		ProcessMax:               -1,
+		MaxConcurrency:           10,
+		Concurrency:              DefaultConcurrencyConfig(),
+		Determine:                DefaultDetermineOptions(),
+		Retry:                    DefaultRetryPolicy(),
+		Overrides:                DefaultOverridesConfig(),
+		Stages:                   DefaultStagesConfig(),
+		Batch:                    DefaultBatchConfig(),
+		Cascade:                  DefaultCascadeConfig(),
+		Review:                   DefaultReviewConfig(),
+		Sweep:                    DefaultSweepConfig(),
+		Consistency:              DefaultConsistencyConfig(),
+		Fresh:                    false,
+	}
+}
+
+// LoadConfig reads the yaml config at path over the defaults.  A missing file leaves the defaults in place.
+func LoadConfig(path string) (Config, error) {
+	config := DefaultConfig()
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			getLogger().Infof("no curate config found at (%s), using defaults", path)
+			return config, nil
+		}
+		return config, fmt.Errorf("failed to read curate config (%s). %w", path, err)
+	}
+
+	if err := yaml.Unmarshal(b, &config); err != nil {
+		return config, fmt.Errorf("failed to unmarshal curate config (%s). %w", path, err)
+	}
+
+	return config, nil
+}
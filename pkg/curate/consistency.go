@@ -0,0 +1,428 @@
+package curate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ozzysoft.net/wordle/pkg/llama"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	consistencyPromptName = "consistency"
+
+	// legacyPrompt and legacyModel group responses read from the legacy response files, which don't record either.
+	legacyPrompt = "legacy"
+	legacyModel  = "unknown"
+)
+
+// ConsistencyJudge sets which responses the consistency check puts to the judge model.
+type ConsistencyJudge string
+
+const (
+	// JudgeNever decides on the cue phrases alone.
+	JudgeNever ConsistencyJudge = "never"
+	// JudgeFlagged asks the judge to confirm the responses the cue phrases flag.
+	JudgeFlagged ConsistencyJudge = "flagged"
+	// JudgeAlways asks the judge about every response, one request per word.
+	JudgeAlways ConsistencyJudge = "always"
+)
+
+// ConsistencyConfig checks that the explanation in a response agrees with its verdict.
+type ConsistencyConfig struct {
+	Judge         ConsistencyJudge `yaml:"judge"`
+	MinConfidence float64          `yaml:"minConfidence"`
+	Determine     DetermineOptions `yaml:"determine"`
+	ReportPath    string           `yaml:"reportPath"`
+}
+
+func DefaultConsistencyConfig() ConsistencyConfig {
+	determine := DefaultDetermineOptions()
+	determine.Prompt = consistencyPromptName
+	return ConsistencyConfig{
+		Judge:         JudgeNever,
+		MinConfidence: 0.7,
+		Determine:     determine,
+		ReportPath:    "data/consistency.json",
+	}
+}
+
+// ConsistencyJudgement is the structured answer of the judge.
+type ConsistencyJudgement struct {
+	Consistent bool    `json:"consistent"`
+	Confidence float64 `json:"confidence"`
+}
+
+// Cue phrases, lowercase words as they appear in an explanation.
+var (
+	commonCues = [][]string{
+		{"common"}, {"commonly"}, {"familiar"}, {"well", "known"}, {"widely"}, {"frequently"}, {"frequent"},
+		{"popular"}, {"recognizable"}, {"recognised"}, {"recognized"}, {"ordinary"},
+	}
+	obscureCues = [][]string{
+		{"obscure"}, {"archaic"}, {"obsolete"}, {"rare"}, {"rarely"}, {"uncommon"}, {"unusual"}, {"unfamiliar"},
+		{"dated"}, {"antiquated"}, {"specialized"}, {"specialised"}, {"technical"}, {"jargon"}, {"dialect"},
+		{"dialectal"}, {"regional"}, {"slang"}, {"misspelling"}, {"misspelled"}, {"typo"}, {"abbreviation"},
+		{"proper", "noun"}, {"foreign"}, {"unknown"}, {"niche"}, {"limited"}, {"little", "known"}, {"esoteric"},
+		{"not", "found"}, {"isn't", "found"}, {"not", "listed"},
+	}
+	negations = map[string]bool{
+		"not": true, "no": true, "never": true, "nor": true, "neither": true, "hardly": true, "barely": true,
+		"less": true, "without": true, "isn't": true, "aren't": true, "wasn't": true, "weren't": true, "doesn't": true,
+		"don't": true, "didn't": true,
+	}
+
+	// textRationale splits a text answer into its leading verdict token and the rationale after the first sentence or
+	// comma boundary, "True. It is rare" as well as "True, because it is rare".
+	textRationale = regexp.MustCompile(`(?is)^[\s*"']*(true|false)\b[*"']*\s*[.,;:!]?(.*)$`)
+
+	rationaleClauses = regexp.MustCompile(`[.,;:!?()\n]+`)
+	rationaleWords   = regexp.MustCompile(`[a-z]+(?:'[a-z]+)?`)
+)
+
+// ConsistencyCheck is the consistency of a response's explanation with its verdict.
+type ConsistencyCheck struct {
+	Word          string   `json:"word"`
+	Decision      Decision `json:"decision"`
+	Obscure       bool     `json:"obscure"`
+	Prompt        string   `json:"prompt"`
+	Model         string   `json:"model"`
+	Supporting    []string `json:"supporting,omitempty"`
+	Opposing      []string `json:"opposing,omitempty"`
+	Cues          bool     `json:"cues"`
+	Judge         string   `json:"judge,omitempty"`
+	Contradictory bool     `json:"contradictory"`
+	Response      string   `json:"response"`
+}
+
+// ConsistencyGroup is the contradiction rate of the responses of a prompt and model.
+type ConsistencyGroup struct {
+	Prompt         string  `json:"prompt"`
+	Model          string  `json:"model"`
+	Responses      int     `json:"responses"`
+	Contradictions int     `json:"contradictions"`
+	Rate           float64 `json:"rate"`
+	Judged         int     `json:"judged"`
+	JudgeOverruled int     `json:"judge_overruled"`
+}
+
+// ConsistencyReport is the outcome of a consistency check.  Responses without a verdict to check aren't counted.
+type ConsistencyReport struct {
+	Judge          ConsistencyJudge   `json:"judge"`
+	JudgeModel     string             `json:"judge_model,omitempty"`
+	Responses      int                `json:"responses"`
+	Contradictions int                `json:"contradictions"`
+	Rate           float64            `json:"rate"`
+	Groups         []ConsistencyGroup `json:"groups"`
+	Contradictory  []ConsistencyCheck `json:"contradictory"`
+	Timestamp      time.Time          `json:"timestamp"`
+}
+
+// checkRationale looks for cue phrases for and against the verdict of a response.
+func checkRationale(word string, decision Decision, response string) (ConsistencyCheck, bool) {
+	check := ConsistencyCheck{Word: word, Decision: decision, Response: response}
+
+	var rationale string
+	if verdict, err := parseJSONVerdict(response); err == nil {
+		check.Obscure = verdict.Obscure
+		rationale = verdict.Definition
+		if !verdict.Obscure {
+			for _, reason := range verdict.Reasons {
+				check.Opposing = append(check.Opposing, "reason "+string(reason))
+			}
+		}
+	} else {
+		match := textRationale.FindStringSubmatch(response)
+		if match == nil {
+			return check, false
+		}
+		check.Obscure = strings.EqualFold(match[1], "true")
+		rationale = match[2]
+	}
+
+	common, obscure := findCues(rationale)
+	if check.Obscure {
+		check.Supporting, check.Opposing = append(check.Supporting, obscure...), append(check.Opposing, common...)
+	} else {
+		check.Supporting, check.Opposing = append(check.Supporting, common...), append(check.Opposing, obscure...)
+	}
+	check.Cues = len(check.Opposing) > len(check.Supporting)
+	check.Contradictory = check.Cues
+	return check, true
+}
+
+// contradictsRationale is true when the cue phrases of a response argue against its verdict.
+func contradictsRationale(word string, response string) bool {
+	check, checked := checkRationale(word, DecisionUndetermined, response)
+	return checked && check.Contradictory
+}
+
+// findCues returns the cue phrases of text that call a word common and those that call it obscure.
+func findCues(text string) ([]string, []string) {
+	var common, obscure []string
+	text = strings.ReplaceAll(strings.ToLower(text), "’", "'")
+	for _, clause := range rationaleClauses.Split(text, -1) {
+		words := rationaleWords.FindAllString(clause, -1)
+		lastEnd, lastNegated := 0, false
+		for i := 0; i < len(words); {
+			cue, isObscure := matchCue(words[i:])
+			if cue == 0 {
+				i++
+				continue
+			}
+
+			phrase := strings.Join(words[i:i+cue], " ")
+			if i > 0 && (words[i-1] == "more" || words[i-1] == "other") {
+				// "compared to more common words" is about other words
+				i += cue
+				continue
+			}
+			negated := false
+			if lastNegated && i > lastEnd && !slices.ContainsFunc(words[lastEnd:i], func(w string) bool { return w != "or" && w != "nor" }) {
+				// "not obscure or unknown"
+				negated, phrase = true, strings.Join(words[lastEnd:i+cue], " ")
+			}
+			for j := i - 1; j >= max(i-4, lastEnd) && !negated && words[j] != "but"; j-- {
+				if negations[words[j]] {
+					negated, phrase = true, strings.Join(words[j:i+cue], " ")
+				}
+			}
+			if negated {
+				isObscure = !isObscure
+			}
+			lastEnd, lastNegated = i+cue, negated
+
+			if isObscure {
+				obscure = append(obscure, phrase)
+			} else {
+				common = append(common, phrase)
+			}
+			i += cue
+		}
+	}
+	return common, obscure
+}
+
+// matchCue returns the length of the longest cue at the start of words, zero for none, and whether it is obscure.
+func matchCue(words []string) (int, bool) {
+	longest, isObscure := 0, false
+	for _, cues := range []struct {
+		phrases [][]string
+		obscure bool
+	}{{commonCues, false}, {obscureCues, true}} {
+		for _, cue := range cues.phrases {
+			if len(cue) > longest && len(cue) <= len(words) && slices.Equal(cue, words[:len(cue)]) {
+				longest, isObscure = len(cue), cues.obscure
+			}
+		}
+	}
+	return longest, isObscure
+}
+
+// CheckConsistency checks the responses of the results file, and of the legacy response files for words the results
+// file doesn't have, putting them to the judge as configured.
+func CheckConsistency(ctx context.Context, backend llama.Backend, config Config) (ConsistencyReport, error) {
+	report := ConsistencyReport{Judge: config.Consistency.Judge, Timestamp: time.Now()}
+	switch config.Consistency.Judge {
+	case JudgeNever:
+	case JudgeFlagged, JudgeAlways:
+		if err := config.resolvePrompts(); err != nil {
+			return report, err
+		}
+		report.JudgeModel = config.Consistency.Determine.model()
+	default:
+		return report, fmt.Errorf("unknown consistency judge (%s), expected never, flagged or always", config.Consistency.Judge)
+	}
+
+	records, err := LoadResultRecords(config.ResultsPath)
+	if err != nil {
+		return report, err
+	}
+	responses, err := loadLegacyResponses(config)
+	if err != nil {
+		return report, err
+	}
+
+	var checks []ConsistencyCheck
+	for word, record := range records {
+		if check, checked := checkRationale(word, record.Decision, record.Response); checked {
+			check.Prompt, check.Model = record.PromptVersion, record.Model
+			checks = append(checks, check)
+		}
+	}
+	for word, legacy := range responses {
+		if _, found := records[word]; found {
+			continue
+		}
+		if check, checked := checkRationale(word, legacy.decision, legacy.response); checked {
+			check.Prompt, check.Model = legacyPrompt, legacyModel
+			checks = append(checks, check)
+		}
+	}
+	slices.SortFunc(checks, func(a, b ConsistencyCheck) int { return strings.Compare(a.Word, b.Word) })
+
+	if config.Consistency.Judge != JudgeNever {
+		judgeChecks(ctx, backend, config, checks)
+		if ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+	}
+
+	groups := make(map[[2]string]*ConsistencyGroup)
+	for _, check := range checks {
+		key := [2]string{check.Prompt, check.Model}
+		group, found := groups[key]
+		if !found {
+			group = &ConsistencyGroup{Prompt: check.Prompt, Model: check.Model}
+			groups[key] = group
+		}
+
+		group.Responses++
+		report.Responses++
+		if check.Judge != "" && check.Judge != "failed" {
+			group.Judged++
+			if check.Contradictory != check.Cues {
+				group.JudgeOverruled++
+			}
+		}
+		if check.Contradictory {
+			group.Contradictions++
+			report.Contradictions++
+			report.Contradictory = append(report.Contradictory, check)
+		}
+	}
+
+	for _, group := range groups {
+		group.Rate = ratio(group.Contradictions, group.Responses)
+		report.Groups = append(report.Groups, *group)
+	}
+	slices.SortFunc(report.Groups, func(a, b ConsistencyGroup) int {
+		if n := strings.Compare(a.Prompt, b.Prompt); n != 0 {
+			return n
+		}
+		return strings.Compare(a.Model, b.Model)
+	})
+	report.Rate = ratio(report.Contradictions, report.Responses)
+
+	getLogger().Infof("consistency check, responses (%d), contradictions (%d), judge (%s)", report.Responses, report.Contradictions, report.Judge)
+	return report, nil
+}
+
+// judgeChecks puts the checks to the judge, up to MaxConcurrency at a time.
+func judgeChecks(ctx context.Context, backend llama.Backend, config Config, checks []ConsistencyCheck) {
+	logger := getLogger()
+	limit := make(chan struct{}, max(config.MaxConcurrency, 1))
+	var wg sync.WaitGroup
+
+	for i := range checks {
+		check := &checks[i]
+		if config.Consistency.Judge == JudgeFlagged && !check.Cues {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		case limit <- struct{}{}:
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-limit }()
+
+			determination := determineWithRetry(ctx, config.Retry, check.Word, func(ctx context.Context) Determination {
+				return askQuestion(ctx, backend, config.Consistency.Determine, check.Word, check.Response)
+			})
+			judgement, err := parseConsistencyJudgement(determination.Response)
+			if determination.Err != nil || err != nil {
+				logger.Warnf("word (%s), consistency judge failed, keeping the cues.  (%s)", check.Word, errors.Join(determination.Err, err))
+				check.Judge = "failed"
+				return
+			}
+
+			if judgement.Consistent {
+				check.Judge = "consistent"
+			} else {
+				check.Judge = "contradictory"
+			}
+			if judgement.Confidence >= config.Consistency.MinConfidence {
+				check.Contradictory = !judgement.Consistent
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// parseConsistencyJudgement decodes and validates a response against the consistency schema.
+func parseConsistencyJudgement(response string) (ConsistencyJudgement, error) {
+	var raw rawConsistencyJudgement
+	if err := decodeJSONAnswer(response, "consistency judgement", &raw); err != nil {
+		return ConsistencyJudgement{}, err
+	}
+
+	return ConsistencyJudgement{Consistent: *raw.Consistent, Confidence: *raw.Confidence}, nil
+}
+
+// rawConsistencyJudgement is the consistency schema as decoded, a nil field was missing from the response.
+type rawConsistencyJudgement struct {
+	Consistent *bool    `json:"consistent"`
+	Confidence *float64 `json:"confidence"`
+}
+
+func (raw *rawConsistencyJudgement) validate() error {
+	switch {
+	case raw.Consistent == nil:
+		return missingField("consistent")
+	case raw.Confidence == nil:
+		return missingField("confidence")
+	}
+	return checkConfidence(*raw.Confidence)
+}
+
+// WriteConsistencyReport writes the report as indented json.
+func WriteConsistencyReport(path string, report ConsistencyReport) error {
+	return writeJSONFile(path, report)
+}
+
+// RequeueWords journals the words as undetermined, so the next curation run asks the model about them again.
+func RequeueWords(config Config, words []string) error {
+	entries, err := LoadJournal(config.JournalPath)
+	if err != nil {
+		return err
+	}
+
+	journal, err := OpenJournal(config.JournalPath, false)
+	if err != nil {
+		return err
+	}
+	defer journal.Close()
+
+	if len(entries) == 0 {
+		responses, err := loadLegacyResponses(config)
+		if err != nil {
+			return err
+		}
+		seed := make([]JournalEntry, 0, len(responses))
+		for word, legacy := range responses {
+			if legacy.decision.IsDecided() {
+				seed = append(seed, JournalEntry{Word: word, Decision: legacy.decision})
+			}
+		}
+		if err := journal.recordAll(seed); err != nil {
+			return err
+		}
+		getLogger().Infof("seeded journal (%s) from the legacy response files, words (%d)", config.JournalPath, len(seed))
+	}
+
+	requeued := make([]JournalEntry, 0, len(words))
+	for _, word := range words {
+		requeued = append(requeued, JournalEntry{Word: word, Decision: DecisionUndetermined})
+	}
+	return journal.recordAll(requeued)
+}
@@ -0,0 +1,87 @@
+package curate
+
+import (
+	"context"
+	"os"
+	"ozzysoft.net/wordle/pkg/llama"
+	"slices"
+	"testing"
+)
+
+func TestFindCuesNegation(t *testing.T) {
+	for _, c := range []struct {
+		text    string
+		common  []string
+		obscure []string
+	}{
+		{"It is an obscure word.", nil, []string{"obscure"}},
+		{"It is not obscure.", []string{"not obscure"}, nil},
+		{"It is not commonly used.", nil, []string{"not commonly"}},
+		{"It is not entirely obscure.", []string{"not entirely obscure"}, nil},
+		{"It is not obscure or unknown.", []string{"not obscure", "or unknown"}, nil},
+		{"It isn't rare, it is familiar.", []string{"isn't rare", "familiar"}, nil},
+		// a negation more than four words back, or before a "but", doesn't reach the cue
+		{"It is not a word that you would call rare.", nil, []string{"rare"}},
+		{"Not a noun but rare.", nil, []string{"rare"}},
+		// "not found" is a cue of its own, and more common words are other words
+		{"The word is not found in dictionaries.", nil, []string{"not found"}},
+		{"Compared to more common words it is archaic.", nil, []string{"archaic"}},
+	} {
+		common, obscure := findCues(c.text)
+		if !slices.Equal(common, c.common) || !slices.Equal(obscure, c.obscure) {
+			t.Errorf("text (%s) has common cues (%q), obscure cues (%q), expected (%q) and (%q)", c.text, common, obscure, c.common, c.obscure)
+		}
+	}
+}
+
+func TestCheckRationale(t *testing.T) {
+	for _, c := range []struct {
+		response      string
+		checked       bool
+		obscure       bool
+		contradictory bool
+	}{
+		{"True. It is an archaic word.", true, true, false},
+		{"True, because it is a common word.", true, true, true},
+		{"False, it is familiar to most people.", true, false, false},
+		{"**False** it is rarely used.", true, false, true},
+		{"True", true, true, false},
+		{"Maybe, it depends.", false, false, false},
+		{`{"obscure": false, "confidence": 0.9, "reasons": ["archaic"], "definition": "a common word"}`, true, false, false},
+		{`{"obscure": false, "confidence": 0.9, "reasons": ["archaic", "slang"], "definition": "a common word"}`, true, false, true},
+	} {
+		check, checked := checkRationale("abbey", DecisionUndetermined, c.response)
+		if checked != c.checked || check.Obscure != c.obscure || check.Contradictory != c.contradictory {
+			t.Errorf("response (%s) checked (%t), obscure (%t), contradictory (%t), supporting (%q), opposing (%q)",
+				c.response, checked, check.Obscure, check.Contradictory, check.Supporting, check.Opposing)
+		}
+	}
+}
+
+func TestRequeueWordsSeedsJournal(t *testing.T) {
+	config := testConfig(t, "abbey", "aahed", "cable")
+	// legacy files and no journal
+	for path, content := range map[string]string{
+		config.CuratedResponsePath:  "abbey: False. A familiar word.\ncable: True. A rare word.\n",
+		config.ExcludedResponsePath: "aahed: True. A rare interjection.\n",
+	} {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := RequeueWords(config, []string{"cable"}); err != nil {
+		t.Fatal(err)
+	}
+	answers := newFakeAnswers(testAnswers)
+	curate(t, context.Background(), llama.NewFakeBackend(answers.respond), config)
+	if answers.total() != 1 || answers.requests["cable"] != 1 {
+		t.Errorf("run after the requeue made requests (%v), expected only cable", answers.requests)
+	}
+	if actual := readLines(t, config.CuratedPath); !slices.Equal(actual, []string{"abbey", "cable"}) {
+		t.Errorf("curated has (%v) after the requeue", actual)
+	}
+	if actual := readLines(t, config.ExcludedPath); !slices.Equal(actual, []string{"aahed"}) {
+		t.Errorf("excluded has (%v) after the requeue", actual)
+	}
+}
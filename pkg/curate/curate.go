@@ -4,63 +4,168 @@ import (
 	"bufio"
 	"context"
 	"fmt"
-	ollama "github.com/ollama/ollama/api"
 	"go.uber.org/zap"
 	"os"
+	"ozzysoft.net/wordle/pkg/llama"
 	"ozzysoft.net/wordle/pkg/log"
 	"strings"
-	"sync/atomic"
 	"time"
 )
 
 type CurateResult struct {
-	word     string
-	exclude  bool
-	response string
-	done     bool
+	word          string
+	decision      Decision
+	reason        UndeterminedReason
+	response      string
+	verdict       *Verdict
+	model         string
+	prompt        string
+	promptVersion string
+	metrics       llama.Metrics
+	err           error
+	votes         []Vote
+	policy        string
+	tier          string
+	escalation    *Escalation
+	attempts      int
+	deadLetter    bool
+	tokensSaved   int
+	batchSize     int
+	tags          []Tag
+	override      *Override
+	latency       time.Duration
+	timestamp     time.Time
+	done          bool
 }
 
-func NewCurateResult(w string, exclude bool, response string) CurateResult {
-	return CurateResult{word: w, exclude: exclude, response: response}
+func NewCurateResult(w string, determination Determination, latency time.Duration) CurateResult {
+	return CurateResult{
+		word:          w,
+		decision:      determination.Decision,
+		reason:        determination.Reason,
+		response:      determination.Response,
+		verdict:       determination.Verdict,
+		model:         determination.Model,
+		prompt:        determination.Prompt,
+		promptVersion: determination.PromptVersion,
+		metrics:       determination.Metrics,
+		err:           determination.Err,
+		votes:         determination.Votes,
+		policy:        determination.Policy,
+		attempts:      determination.Attempts,
+		deadLetter:    determination.DeadLetter,
+		tokensSaved:   determination.TokensSaved,
+		batchSize:     determination.BatchSize,
+		tags:          determination.Tags,
+		latency:       latency,
+		timestamp:     time.Now(),
+	}
 }
 
 func NewTerminalCurateResult() CurateResult {
 	return CurateResult{done: true}
 }
 
-func Curate(ctx context.Context, client *ollama.Client, path string) error {
+func Curate(ctx context.Context, backend llama.Backend, config Config) error {
+	return curateWordFile(ctx, backend, config, config.InputPath)
+}
+
+// curateWordFile curates the words in path, the input list or the dead letters taken from it.
+func curateWordFile(ctx context.Context, backend llama.Backend, config Config, path string) error {
 	logger := getLogger()
-	processMax := -1
-	maxConcurrency := 10
-	verbose := false
 
-	logger.Infof("starting curation, process max (%d), concurrency max (%d)", processMax, maxConcurrency)
+	logger.Infof("starting curation, process max (%d), concurrency max (%d), adaptive concurrency (%t), fresh (%t)", config.ProcessMax, config.MaxConcurrency, config.Concurrency.Adaptive, config.Fresh)
 
-	curateResultChannel := make(chan CurateResult, 100)
-	wordChannel := make(chan string, 100)
-	worker := NewWordWorker(maxConcurrency, wordChannel, curateResultChannel, client, verbose)
+	if err := config.resolvePrompts(); err != nil {
+		return err
+	}
 
-	resultsDone := make(chan interface{})
-	go handleResults(ctx, "data/curated.txt", "data/curated.response.txt", "data/excluded.txt", "data/excluded.response.txt", curateResultChannel, resultsDone)
+	overrides, err := LoadOverrides(config.Overrides)
+	if err != nil {
+		return err
+	}
 
-	go worker.processWordChannel(ctx)
+	completed := make(map[string]JournalEntry)
+	if !config.Fresh {
+		entries, err := LoadJournal(config.JournalPath)
+		if err != nil {
+			return err
+		}
+		completed = entries
+	}
+	resume := !config.Fresh && (len(completed) > 0 || config.Append)
+	var records map[string]ResultRecord
+	if resume {
+		logger.Infof("resuming from journal (%s), completed words (%d)", config.JournalPath, len(completed))
+		if records, err = LoadResultRecords(config.ResultsPath); err != nil {
+			return err
+		}
+	}
+
+	manifest := newRunManifest(ctx, backend, config, resume)
+
+	journal, err := OpenJournal(config.JournalPath, !resume)
+	if err != nil {
+		return err
+	}
 
 	wordFile, err := os.Open(path)
 	if err != nil {
+		journal.Close()
 		return fmt.Errorf("failed to open word file (%s). %w", path, err)
 	}
 	defer doClose(wordFile)
 
+	stats := &RunStats{}
+	curateResultChannel := make(chan CurateResult, 100)
+	wordChannel := make(chan string, 100)
+	worker, err := startWorkers(ctx, backend, config, stats, wordChannel, curateResultChannel)
+	if err != nil {
+		journal.Close()
+		return err
+	}
+
+	resultsDone := make(chan interface{})
+	go handleResults(ctx, config, resume, records, journal, overrides, stats, curateResultChannel, resultsDone)
+
 	start := time.Now()
 	count := 0
+	skipped := 0
+	overridden := 0
 	scanner := bufio.NewScanner(wordFile)
 loop:
 	for scanner.Scan() {
 		w := scanner.Text()
 		w = strings.TrimSpace(w)
 		count += 1
-		if processMax < 0 || count <= processMax {
-			wordChannel <- w
+		record, recorded := records[w]
+		if entry, found := completed[w]; found && entry.Decision.IsDecided() && !overrides.changes(entry, record) {
+			skipped += 1
+			continue
+		}
+		if config.ProcessMax < 0 || count-skipped <= config.ProcessMax {
+			// the sends give way to a cancel, the workers and results handler have stopped reading by then
+			if _, found := overrides.Lookup(w); found {
+				// no model call, handleResults applies the override, to the earlier model answer when there is one
+				overridden += 1
+				result := NewCurateResult(w, Determination{Decision: DecisionUndetermined}, 0)
+				if recorded && record.Decision.IsDecided() {
+					result = resultFromRecord(record)
+				}
+				select {
+				case curateResultChannel <- result:
+				case <-ctx.Done():
+					logger.Infof("context closed, curation exiting")
+					break loop
+				}
+			} else {
+				select {
+				case wordChannel <- w:
+				case <-ctx.Done():
+					logger.Infof("context closed, curation exiting")
+					break loop
+				}
+			}
 		}
 
 		select {
@@ -72,63 +177,174 @@ loop:
 		}
 	}
 
-	logger.Infof("read file (%s), found words (%d)", path, count)
+	logger.Infof("read file (%s), found words (%d), skipped completed words (%d), overridden words (%d)", path, count, skipped, overridden)
 	close(wordChannel)
 
+	// the results handler also exits when the context closes, after writing the results it has
+	logger.Infof("waiting for curate results to be processed")
+	<-resultsDone
+	logger.Infof("done channel closed")
+
 	if err := scanner.Err(); err != nil {
 		return fmt.Errorf("failed to read word file (%s). %w", path, err)
 	}
 
-	logger.Infof("waiting for curate results to be processed")
-	select {
-	case <-ctx.Done():
-		logger.Infof("context closed, curation exiting")
-	case <-resultsDone:
-		logger.Infof("done channel closed")
+	elapsed := time.Since(start)
+	processed := worker.processCount.Load()
+	avg := 0.0
+	if processed > 0 {
+		avg = float64(elapsed.Milliseconds()) / float64(processed)
 	}
+	logger.Infof("elapsed (%s), count (%d), average elapsed milliseconds (%f)", elapsed, processed, avg)
+	stats.report(logger)
 
-	elapsed := time.Since(start)
-	avg := float64(elapsed.Milliseconds()) / float64(processMax)
-	logger.Infof("elapsed (%s), count (%d), average elapsed milliseconds (%f)", elapsed, processMax, avg)
+	manifest.finish(stats, count, skipped, ctx.Err() != nil)
+	dir, err := WriteRun(config.RunsDir, manifest, config.ResultsPath)
+	if err != nil {
+		return err
+	}
+	logger.Infof("wrote run (%s)", dir)
 	return nil
 }
 
-func handleResults(ctx context.Context, path string, responsePath string, excludedPath string, excludedResponsePath string, c <-chan CurateResult, done chan<- interface{}) {
+// startWorkers starts the cascade when it is enabled, otherwise a single WordWorker.
+func startWorkers(ctx context.Context, backend llama.Backend, config Config, stats *RunStats, wordChannel <-chan string, resultChannel chan<- CurateResult) (*WordWorker, error) {
+	stages, err := NewStages(backend, config)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Cascade.Enabled {
+		if config.Batch.Size > 1 {
+			return nil, fmt.Errorf("batched curation doesn't support the cascade")
+		}
+		return startCascade(ctx, backend, config, stages, stats, wordChannel, resultChannel)
+	}
+
+	if config.Batch.Size > 1 {
+		if len(config.Ensemble.Voters) > 0 {
+			return nil, fmt.Errorf("batched curation doesn't support ensemble voters")
+		}
+		if config.Determine.Format != FormatJSON {
+			return nil, fmt.Errorf("batched curation needs the json format, not (%s)", config.Determine.Format)
+		}
+		if prompt := config.Determine.prompt(); prompt.Batch == "" {
+			return nil, fmt.Errorf("batched curation needs a prompt with a batch template, (%s) has none", prompt.Name)
+		}
+
+		classifier := NewBatchClassifier(backend, config.Determine, config.Retry, stages, stats)
+		worker := NewBatchWordWorker(NewLimiter(config.MaxConcurrency, config.Concurrency), wordChannel, resultChannel, classifier, config.Batch)
+		go worker.processWordChannel(ctx)
+		return worker, nil
+	}
+
+	classifier, err := NewClassifier(backend, config.Determine, config.Ensemble, config.Retry)
+	if err != nil {
+		return nil, err
+	}
+
+	worker := NewWordWorker(NewLimiter(config.MaxConcurrency, config.Concurrency), wordChannel, resultChannel, NewStagedClassifier(stages, classifier, stats))
+	go worker.processWordChannel(ctx)
+	return worker, nil
+}
+
+// ReprocessDeadLetters curates only the words in the dead letter file, appending to the existing outputs.
+func ReprocessDeadLetters(ctx context.Context, backend llama.Backend, config Config) error {
 	logger := getLogger()
-	logger.Infof("starting to curated results handler")
+	retryPath := config.DeadLetterPath + ".retry"
 
-	curated, err := os.Create(path)
+	// a retry file left behind by an interrupted reprocess still holds words that need curating
+	if _, err := os.Stat(retryPath); err == nil {
+		logger.Infof("found interrupted dead letter retry file (%s), reprocessing it", retryPath)
+	} else if err := os.Rename(config.DeadLetterPath, retryPath); err != nil {
+		return fmt.Errorf("failed to move dead letter file (%s) aside. %w", config.DeadLetterPath, err)
+	}
+
+	config.Fresh = false
+	config.Append = true
+	if err := curateWordFile(ctx, backend, config, retryPath); err != nil {
+		return err
+	}
+
+	if ctx.Err() != nil {
+		logger.Infof("dead letter reprocessing interrupted, keeping retry file (%s)", retryPath)
+		return nil
+	}
+
+	if err := os.Remove(retryPath); err != nil {
+		return fmt.Errorf("failed to remove dead letter retry file (%s). %w", retryPath, err)
+	}
+	return nil
+}
+
+// openWriters opens the result writers, seeding the sorted ones with records when resuming.
+func openWriters(config Config, resume bool, records map[string]ResultRecord) ([]ResultWriter, error) {
+	writers := make([]ResultWriter, 0, 4)
+
+	jsonl, err := NewJSONLWriter(config.ResultsPath, resume)
 	if err != nil {
-		logger.Errorf("failed to create curated file at path (%s)", path)
-		return
+		return nil, err
 	}
-	defer doClose(curated)
+	writers = append(writers, jsonl)
 
-	curatedResponse, err := os.Create(responsePath)
+	deadLetters, err := NewDeadLetterWriter(config.DeadLetterPath, resume)
 	if err != nil {
-		logger.Errorf("failed to create curated file at path (%s)", responsePath)
-		return
+		closeWriters(writers)
+		return nil, err
 	}
-	defer doClose(curatedResponse)
+	writers = append(writers, deadLetters)
 
-	excluded, err := os.Create(excludedPath)
+	sensitive, err := NewSensitiveWriter(config.SensitivePath, config.SensitiveResponsePath, resume)
 	if err != nil {
-		logger.Errorf("failed to create excluded file at path (%s)", excludedPath)
-		return
+		closeWriters(writers)
+		return nil, err
 	}
-	defer doClose(excluded)
+	writers = append(writers, sensitive)
 
-	excludedResponse, err := os.Create(excludedResponsePath)
+	if config.LegacyOutput {
+		legacy, err := NewLegacyWriter(config, resume)
+		if err != nil {
+			closeWriters(writers)
+			return nil, err
+		}
+		writers = append(writers, legacy)
+	}
+
+	for _, writer := range writers {
+		if sorted, ok := writer.(sortedWriter); ok {
+			for _, record := range records {
+				sorted.add(record)
+			}
+		}
+	}
+
+	return writers, nil
+}
+
+func closeWriters(writers []ResultWriter) {
+	for _, writer := range writers {
+		writer.Close()
+	}
+}
+
+// handleResults writes the results, with the overrides applied, and journals them.
+func handleResults(ctx context.Context, config Config, resume bool, records map[string]ResultRecord, journal *Journal, overrides *Overrides, stats *RunStats, c <-chan CurateResult, done chan<- interface{}) {
+	logger := getLogger()
+	logger.Infof("starting to curated results handler, resume (%t)", resume)
+	defer close(done)
+	defer journal.Close()
+
+	writers, err := openWriters(config, resume, records)
 	if err != nil {
-		logger.Errorf("failed to create excluded file at path (%s)", excludedResponsePath)
+		logger.Errorf("failed to open result writers.  (%s)", err)
 		return
 	}
-	defer doClose(excludedResponse)
+	defer closeWriters(writers)
 
-	excludedCount := atomic.Int32{}
-	curatedCount := atomic.Int32{}
 	report := func() {
-		logger.Infof("results handler processing completed, curated count (%d), excluded count (%d)", curatedCount.Load(), excludedCount.Load())
+		counts := stats.counts()
+		logger.Infof("results handler processing completed, curated count (%d), excluded count (%d), guess only count (%d), undetermined count (%d), overridden count (%d)",
+			counts.Curated, counts.Excluded, counts.GuessOnly, counts.Undetermined, counts.Overridden)
 	}
 	defer report()
 
@@ -145,37 +361,23 @@ func handleResults(ctx context.Context, path string, responsePath string, exclud
 
 			if result.done {
 				// terminal result, exit the process.
-				close(done)
 				logger.Warnf("received terminal results message, exiting")
 				return
 			}
 
-			if result.exclude {
-				excludedCount.Add(1)
-				_, err = excluded.WriteString(result.word + "\n")
-				if err != nil {
-					logger.Errorf("failed to write to excluded file, exiting")
-					return
-				}
+			result = overrides.apply(result)
+			stats.record(result)
 
-				_, err = excludedResponse.WriteString(fmt.Sprintf("%s: %s\n", result.word, result.response))
-				if err != nil {
-					logger.Errorf("failed to write to excluded response file, exiting")
-					return
-				}
-			} else {
-				curatedCount.Add(1)
-				_, err = curated.WriteString(result.word + "\n")
-				if err != nil {
-					logger.Errorf("failed to write to curated file, exiting")
+			for _, writer := range writers {
+				if err := writer.Write(result); err != nil {
+					logger.Errorf("failed to write result, exiting.  (%s)", err)
 					return
 				}
+			}
 
-				_, err = curatedResponse.WriteString(fmt.Sprintf("%s: %s\n", result.word, result.response))
-				if err != nil {
-					logger.Errorf("failed to write to curated response file, exiting")
-					return
-				}
+			if err := journal.Record(result); err != nil {
+				logger.Errorf("failed to record word in journal, exiting.  (%s)", err)
+				return
 			}
 		}
 	}
@@ -0,0 +1,444 @@
+package curate
+
+import (
+	"context"
+	"io"
+	"os"
+	"ozzysoft.net/wordle/pkg/llama"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeAnswers answers text prompts from a word to response map, counting the requests per word.
+type fakeAnswers struct {
+	mu       sync.Mutex
+	answers  map[string]string
+	requests map[string]int
+}
+
+func newFakeAnswers(answers map[string]string) *fakeAnswers {
+	return &fakeAnswers{answers: answers, requests: make(map[string]int)}
+}
+
+func (f *fakeAnswers) respond(request llama.GenerateRequest) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests[request.Subject]++
+	return f.answers[request.Subject]
+}
+
+func (f *fakeAnswers) total() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	total := 0
+	for _, n := range f.requests {
+		total += n
+	}
+	return total
+}
+
+// testConfig writes words to a temporary input file and points every output there, with the stages off and no retries.
+func testConfig(t *testing.T, words ...string) Config {
+	t.Helper()
+	dir := t.TempDir()
+
+	config := DefaultConfig()
+	config.InputPath = filepath.Join(dir, "words.txt")
+	config.CuratedPath = filepath.Join(dir, "curated.txt")
+	config.CuratedResponsePath = filepath.Join(dir, "curated.response.txt")
+	config.ExcludedPath = filepath.Join(dir, "excluded.txt")
+	config.ExcludedResponsePath = filepath.Join(dir, "excluded.response.txt")
+	config.UndeterminedPath = filepath.Join(dir, "undetermined.txt")
+	config.UndeterminedResponsePath = filepath.Join(dir, "undetermined.response.txt")
+	config.GuessOnlyPath = filepath.Join(dir, "guess-only.txt")
+	config.GuessOnlyResponsePath = filepath.Join(dir, "guess-only.response.txt")
+	config.JournalPath = filepath.Join(dir, "curate.journal")
+	config.ResultsPath = filepath.Join(dir, "results.jsonl")
+	config.RunsDir = filepath.Join(dir, "runs")
+	config.DeadLetterPath = filepath.Join(dir, "deadletter.txt")
+	config.SensitivePath = filepath.Join(dir, "sensitive.txt")
+	config.SensitiveResponsePath = filepath.Join(dir, "sensitive.response.txt")
+	config.PromptDir = filepath.Join(dir, "prompts")
+	config.Overrides = OverridesConfig{
+		IncludePath:   filepath.Join(dir, "include.txt"),
+		ExcludePath:   filepath.Join(dir, "exclude.txt"),
+		GuessOnlyPath: filepath.Join(dir, "guess-only-overrides.txt"),
+	}
+	config.Determine.Format = FormatText
+	config.Retry.MaxAttempts = 1
+	config.Stages.Sensitive.Mode = StagePass
+	config.Stages.Morphology.Mode = StagePass
+	config.Stages.ProperNoun.Mode = StagePass
+
+	if err := os.WriteFile(config.InputPath, []byte(strings.Join(words, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return config
+}
+
+func readLines(t *testing.T, path string) []string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Fields(string(b))
+}
+
+func curate(t *testing.T, ctx context.Context, backend llama.Backend, config Config) {
+	t.Helper()
+	if err := Curate(ctx, backend, config); err != nil {
+		t.Fatalf("curate failed. %s", err)
+	}
+}
+
+var testAnswers = map[string]string{
+	"abbey": "False. A familiar word.",
+	"aahed": "True. A rare interjection.",
+	"zzzzz": "Maybe, it depends.",
+	"cable": "False. Common.",
+}
+
+func TestCurateDecisions(t *testing.T) {
+	config := testConfig(t, "abbey", "aahed", "zzzzz", "cable")
+	answers := newFakeAnswers(testAnswers)
+	curate(t, context.Background(), llama.NewFakeBackend(answers.respond), config)
+
+	for path, expected := range map[string][]string{
+		config.CuratedPath:      {"abbey", "cable"},
+		config.ExcludedPath:     {"aahed"},
+		config.UndeterminedPath: {"zzzzz"},
+	} {
+		if actual := readLines(t, path); !slices.Equal(actual, expected) {
+			t.Errorf("(%s) has (%v), expected (%v)", filepath.Base(path), actual, expected)
+		}
+	}
+
+	records, err := LoadResultRecords(config.ResultsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record := records["zzzzz"]; record.Decision != DecisionUndetermined || record.Reason != string(ReasonUnparseable) {
+		t.Errorf("zzzzz has decision (%s), reason (%s), expected undetermined, unparseable", record.Decision, record.Reason)
+	}
+	if record := records["aahed"]; record.Decision != DecisionExclude || record.Response != testAnswers["aahed"] {
+		t.Errorf("aahed has decision (%s), response (%s)", record.Decision, record.Response)
+	}
+}
+
+func TestCurateResumeSkipsCompleted(t *testing.T) {
+	config := testConfig(t, "abbey", "aahed", "zzzzz")
+	curate(t, context.Background(), llama.NewFakeBackend(newFakeAnswers(testAnswers).respond), config)
+
+	// a second run only asks about the undetermined word, and keeps the decided ones
+	answers := newFakeAnswers(map[string]string{"abbey": "True.", "aahed": "False.", "zzzzz": "False. Common after all."})
+	curate(t, context.Background(), llama.NewFakeBackend(answers.respond), config)
+
+	if total, retried := answers.total(), answers.requests["zzzzz"]; total != 1 || retried != 1 {
+		t.Errorf("resume made requests (%v), expected only zzzzz", answers.requests)
+	}
+	if actual := readLines(t, config.CuratedPath); !slices.Equal(actual, []string{"abbey", "zzzzz"}) {
+		t.Errorf("curated has (%v) after resume", actual)
+	}
+	if actual := readLines(t, config.ExcludedPath); !slices.Equal(actual, []string{"aahed"}) {
+		t.Errorf("excluded has (%v) after resume", actual)
+	}
+	if actual := readLines(t, config.UndeterminedPath); len(actual) != 0 {
+		t.Errorf("undetermined has (%v) after resume", actual)
+	}
+}
+
+func TestCurateFresh(t *testing.T) {
+	config := testConfig(t, "abbey", "aahed")
+	curate(t, context.Background(), llama.NewFakeBackend(newFakeAnswers(testAnswers).respond), config)
+
+	config.Fresh = true
+	answers := newFakeAnswers(testAnswers)
+	curate(t, context.Background(), llama.NewFakeBackend(answers.respond), config)
+	if answers.total() != 2 {
+		t.Errorf("fresh run made requests (%v), expected every word", answers.requests)
+	}
+}
+
+func TestCurateProcessMax(t *testing.T) {
+	config := testConfig(t, "abbey", "aahed", "zzzzz", "cable")
+	config.ProcessMax = 2
+	answers := newFakeAnswers(testAnswers)
+	curate(t, context.Background(), llama.NewFakeBackend(answers.respond), config)
+
+	if answers.total() != 2 || answers.requests["abbey"] != 1 || answers.requests["aahed"] != 1 {
+		t.Errorf("process max (2) made requests (%v), expected abbey and aahed", answers.requests)
+	}
+
+	// the limit counts words processed by this run, not the completed ones skipped
+	answers = newFakeAnswers(testAnswers)
+	curate(t, context.Background(), llama.NewFakeBackend(answers.respond), config)
+	if answers.total() != 2 || answers.requests["zzzzz"] != 1 || answers.requests["cable"] != 1 {
+		t.Errorf("resumed process max (2) made requests (%v), expected zzzzz and cable", answers.requests)
+	}
+}
+
+func TestCurateCancel(t *testing.T) {
+	words := make([]string, 1000)
+	for i := range words {
+		words[i] = "abbey"
+	}
+	config := testConfig(t, words...)
+	config.MaxConcurrency = 1
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// the first answer is slow, so the word channel fills before the run is cancelled
+	backend := llama.NewFakeBackend(func(request llama.GenerateRequest) string {
+		time.Sleep(200 * time.Millisecond)
+		cancel()
+		return "False."
+	})
+
+	done := make(chan error)
+	go func() { done <- Curate(ctx, backend, config) }()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("curate didn't return after the run was cancelled")
+	}
+}
+
+func TestReprocessDeadLetters(t *testing.T) {
+	config := testConfig(t, "abbey", "aahed", "cable")
+	// an earlier run's legacy files, with cable dead lettered
+	for path, content := range map[string]string{
+		config.CuratedResponsePath:  "abbey: False. A familiar word.\n",
+		config.ExcludedResponsePath: "aahed: True. A rare interjection.\n",
+		config.DeadLetterPath:       "cable\n",
+	} {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	answers := newFakeAnswers(testAnswers)
+	if err := ReprocessDeadLetters(context.Background(), llama.NewFakeBackend(answers.respond), config); err != nil {
+		t.Fatal(err)
+	}
+	if answers.total() != 1 || answers.requests["cable"] != 1 {
+		t.Errorf("reprocess made requests (%v), expected only cable", answers.requests)
+	}
+
+	for path, expected := range map[string][]string{
+		config.CuratedPath:          {"abbey", "cable"},
+		config.CuratedResponsePath:  {"abbey: False. A familiar word.", "cable: False. Common."},
+		config.ExcludedPath:         {"aahed"},
+		config.ExcludedResponsePath: {"aahed: True. A rare interjection."},
+	} {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual := strings.Split(strings.TrimSpace(string(b)), "\n"); !slices.Equal(actual, expected) {
+			t.Errorf("(%s) has (%q), expected (%q)", filepath.Base(path), actual, expected)
+		}
+	}
+}
+
+// failingBackend fails the generate requests of a model with a retryable error.
+type failingBackend struct {
+	*llama.FakeBackend
+	model string
+}
+
+func (b *failingBackend) Generate(ctx context.Context, request llama.GenerateRequest) (llama.GenerateResponse, error) {
+	if request.Model == b.model {
+		return llama.GenerateResponse{}, io.ErrUnexpectedEOF
+	}
+	return b.FakeBackend.Generate(ctx, request)
+}
+
+func TestCascadeDeadLetters(t *testing.T) {
+	config := testConfig(t, "abbey", "cable")
+	config.Cascade.Enabled = true
+	config.Cascade.Fast.Determine.Model = "fast"
+	config.Cascade.Fast.Determine.Format = FormatText
+	config.Cascade.Strong.Determine.Model = "strong"
+	config.Cascade.Strong.Determine.Format = FormatText
+	config.Concurrency.Adaptive = true
+
+	// the fast tier can't be reached, its words are dead lettered rather than sent to the strong tier
+	answers := newFakeAnswers(testAnswers)
+	curate(t, context.Background(), &failingBackend{FakeBackend: llama.NewFakeBackend(answers.respond), model: "fast"}, config)
+	if answers.total() != 0 {
+		t.Errorf("strong tier made requests (%v) for transport failures", answers.requests)
+	}
+	if actual := readLines(t, config.DeadLetterPath); !slices.Equal(actual, []string{"abbey", "cable"}) {
+		t.Errorf("dead letters have (%v), expected every word", actual)
+	}
+}
+
+func TestClassifier(t *testing.T) {
+	options := DefaultDetermineOptions()
+	options.Format = FormatText
+	retry := DefaultRetryPolicy()
+	retry.MaxAttempts = 1
+
+	classifier, err := NewClassifier(llama.NewFakeBackend(newFakeAnswers(testAnswers).respond), options, EnsembleConfig{}, retry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for word, expected := range map[string]Decision{
+		"abbey": DecisionKeep,
+		"aahed": DecisionExclude,
+		"zzzzz": DecisionUndetermined,
+	} {
+		if determination := classifier.Classify(context.Background(), word); determination.Decision != expected {
+			t.Errorf("word (%s) classified (%s), expected (%s)", word, determination.Decision, expected)
+		}
+	}
+}
+
+func TestCurateOverrideRemoved(t *testing.T) {
+	config := testConfig(t, "abbey", "aahed")
+	if err := os.WriteFile(config.Overrides.ExcludePath, []byte("abbey | a church | sam\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	answers := newFakeAnswers(testAnswers)
+	curate(t, context.Background(), llama.NewFakeBackend(answers.respond), config)
+	if answers.requests["abbey"] != 0 {
+		t.Errorf("overridden abbey was put to the model")
+	}
+	if actual := readLines(t, config.ExcludedPath); !slices.Equal(actual, []string{"aahed", "abbey"}) {
+		t.Errorf("excluded has (%v) with the override", actual)
+	}
+
+	// without the override the model decides again, and the results no longer carry it
+	if err := os.Remove(config.Overrides.ExcludePath); err != nil {
+		t.Fatal(err)
+	}
+	answers = newFakeAnswers(testAnswers)
+	curate(t, context.Background(), llama.NewFakeBackend(answers.respond), config)
+	if answers.total() != 1 || answers.requests["abbey"] != 1 {
+		t.Errorf("run after removing the override made requests (%v), expected only abbey", answers.requests)
+	}
+	if actual := readLines(t, config.CuratedPath); !slices.Equal(actual, []string{"abbey"}) {
+		t.Errorf("curated has (%v) after removing the override", actual)
+	}
+	records, err := LoadResultRecords(config.ResultsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record := records["abbey"]; record.Override != nil || record.Decision != DecisionKeep {
+		t.Errorf("abbey has decision (%s), override (%v) after removing the override", record.Decision, record.Override)
+	}
+}
+
+func TestCurateOverrideAgrees(t *testing.T) {
+	config := testConfig(t, "abbey", "aahed")
+	curate(t, context.Background(), llama.NewFakeBackend(newFakeAnswers(testAnswers).respond), config)
+
+	// an override agreeing with the model is recorded without asking again, keeping the model's answer
+	if err := os.WriteFile(config.Overrides.IncludePath, []byte("abbey | a church | sam\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	answers := newFakeAnswers(testAnswers)
+	curate(t, context.Background(), llama.NewFakeBackend(answers.respond), config)
+	if answers.total() != 0 {
+		t.Errorf("run with an agreeing override made requests (%v)", answers.requests)
+	}
+	records, err := LoadResultRecords(config.ResultsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := records["abbey"]
+	if record.Override == nil || record.Override.Author != "sam" || record.Decision != DecisionKeep || record.Response != testAnswers["abbey"] {
+		t.Errorf("abbey has decision (%s), override (%v), response (%s)", record.Decision, record.Override, record.Response)
+	}
+
+	// once recorded it is skipped
+	answers = newFakeAnswers(testAnswers)
+	curate(t, context.Background(), llama.NewFakeBackend(answers.respond), config)
+	if records, err = LoadResultRecords(config.ResultsPath); err != nil {
+		t.Fatal(err)
+	}
+	if answers.total() != 0 || records["abbey"].Override == nil {
+		t.Errorf("run after recording the override made requests (%v), override (%v)", answers.requests, records["abbey"].Override)
+	}
+}
+
+func TestReadResponseFilesContinuation(t *testing.T) {
+	config := testConfig(t, "abbey", "aahed")
+	response := "abbey: False. A familiar word.\naahed: True. A rare interjection.\nabout: aah, as in delight.\n"
+	if err := os.WriteFile(config.ExcludedResponsePath, []byte(response), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// about is as long as the words, only the input list tells it apart
+	responses, err := loadLegacyResponses(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "True. A rare interjection.\nabout: aah, as in delight."; len(responses) != 2 || responses["aahed"].response != expected {
+		t.Errorf("response files read (%v), expected aahed to be (%q)", responses, expected)
+	}
+}
+
+func TestRunDirectories(t *testing.T) {
+	config := testConfig(t, "abbey", "aahed")
+	curate(t, context.Background(), llama.NewFakeBackend(newFakeAnswers(testAnswers).respond), config)
+	config.Fresh = true
+	curate(t, context.Background(), llama.NewFakeBackend(newFakeAnswers(map[string]string{"abbey": "True.", "aahed": "True."}).respond), config)
+
+	entries, err := os.ReadDir(config.RunsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("runs dir has (%d) runs, expected one per run", len(entries))
+	}
+
+	// each run keeps its own results, found by run id whatever the working directory
+	for i, expected := range []Decision{DecisionKeep, DecisionExclude} {
+		id := entries[i].Name()
+		manifest, err := LoadRunManifest(filepath.Join(config.RunsDir, id, "manifest.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if manifest.RunID != id || manifest.ResultsPath != "results.jsonl" {
+			t.Errorf("run (%s) has manifest id (%s), results path (%s)", id, manifest.RunID, manifest.ResultsPath)
+		}
+
+		records, err := LoadRun(ResolveRun(config.RunsDir, id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != 2 || records["abbey"].Decision != expected {
+			t.Errorf("run (%s) loaded records (%v), expected abbey (%s)", id, records, expected)
+		}
+	}
+}
+
+func TestRunModels(t *testing.T) {
+	config := testConfig(t)
+	config.Determine.Model = "llama3.2"
+	if models := runModels(config); !slices.Equal(models, []string{"llama3.2"}) {
+		t.Errorf("single model run has models (%v)", models)
+	}
+
+	config.Ensemble.Voters = []Voter{{Model: "mistral"}, {Model: "qwen2.5"}}
+	if models := runModels(config); !slices.Equal(models, []string{"mistral", "qwen2.5"}) {
+		t.Errorf("ensemble run has models (%v), expected the voters", models)
+	}
+
+	config.Cascade.Enabled = true
+	config.Cascade.Fast.Determine.Model = "llama3.2:1b"
+	config.Cascade.Strong.Ensemble.Voters = []Voter{{Model: "qwen2.5:14b"}, {Model: "mistral"}}
+	if models := runModels(config); !slices.Equal(models, []string{"llama3.2:1b (fast)", "qwen2.5:14b (strong)", "mistral (strong)"}) {
+		t.Errorf("cascade run has models (%v), expected the tier models", models)
+	}
+	if model := tierModels(firstTier(config), "")[0]; model != "llama3.2:1b" {
+		t.Errorf("cascade run has model (%s), expected the fast tier's", model)
+	}
+}
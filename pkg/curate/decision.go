@@ -0,0 +1,57 @@
+package curate
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+// Decision is the curation outcome for a word.
+type Decision string
+
+const (
+	DecisionKeep         Decision = "keep"
+	DecisionExclude      Decision = "exclude"
+	DecisionUndetermined Decision = "undetermined"
+	// DecisionGuessOnly accepts the word as a guess but never uses it as an answer.  Only overrides make it.
+	DecisionGuessOnly Decision = "guess_only"
+)
+
+// UndeterminedReason explains why no decision could be made for a word.
+type UndeterminedReason string
+
+const (
+	ReasonNone        UndeterminedReason = ""
+	ReasonTransport   UndeterminedReason = "transport_error"
+	ReasonTimeout     UndeterminedReason = "timeout"
+	ReasonUnparseable UndeterminedReason = "unparseable"
+	ReasonEmpty       UndeterminedReason = "empty"
+	// ReasonLowConfidence is a valid verdict below the configured confidence threshold.
+	ReasonLowConfidence UndeterminedReason = "low_confidence"
+)
+
+// IsDecided returns true when the decision is final, undetermined words should be retried or reviewed.
+func (d Decision) IsDecided() bool {
+	return d == DecisionKeep || d == DecisionExclude || d == DecisionGuessOnly
+}
+
+func decisionFromBool(exclude bool) Decision {
+	if exclude {
+		return DecisionExclude
+	}
+	return DecisionKeep
+}
+
+// reasonForError classifies a failed model call.
+func reasonForError(err error) UndeterminedReason {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ReasonTimeout
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ReasonTimeout
+	}
+
+	return ReasonTransport
+}
@@ -3,53 +3,201 @@ package curate
 import (
 	"context"
 	"fmt"
-	ollama "github.com/ollama/ollama/api"
+	"ozzysoft.net/wordle/pkg/llama"
 	"strconv"
 	"strings"
 )
 
-func IsWordRareOrObscure(ctx context.Context, client *ollama.Client, word string, verbose bool) (bool, string) {
+const defaultModel = "llama3.2"
+
+// DetermineOptions controls how a word is put to the model.
+type DetermineOptions struct {
+	Prompt      string         `yaml:"prompt"`
+	Model       string         `yaml:"model"`
+	Format      ResponseFormat `yaml:"format"`
+	Temperature *float64       `yaml:"temperature"`
+	Seed        *int           `yaml:"seed"`
+	// MinConfidence leaves json verdicts below this confidence undetermined.
+	MinConfidence float64 `yaml:"minConfidence"`
+	Verbose       bool    `yaml:"verbose"`
+	// EarlyExit stops the answer once its verdict parses, MaxTokens caps it.
+	EarlyExit       bool `yaml:"earlyExit"`
+	MaxTokens       int  `yaml:"maxTokens"`
+	ReferenceTokens int  `yaml:"referenceTokens"`
+
+	definition *PromptDefinition
+}
+
+func DefaultDetermineOptions() DetermineOptions {
+	return DetermineOptions{Format: FormatJSON, MinConfidence: 0, Verbose: false, ReferenceTokens: defaultReferenceTokens}
+}
+
+// requestOptions returns the model options for a generate request.
+func (o DetermineOptions) requestOptions() map[string]interface{} {
+	options := make(map[string]interface{})
+	if o.Temperature != nil {
+		options["temperature"] = *o.Temperature
+	}
+	if o.Seed != nil {
+		options["seed"] = *o.Seed
+	}
+	if o.MaxTokens > 0 {
+		options["num_predict"] = o.MaxTokens
+	}
+	return options
+}
+
+// Determination is the outcome of asking the model about a single word, along with the provenance of the answer.
+type Determination struct {
+	Decision      Decision
+	Reason        UndeterminedReason
+	Response      string
+	Verdict       *Verdict
+	Model         string
+	Prompt        string
+	PromptVersion string
+	Metrics       llama.Metrics
+	Err           error
+	// Votes and Policy are set by an ensemble, one vote per voter sample.
+	Votes    []Vote
+	Policy   string
+	Attempts int
+	// DeadLetter is set when a retryable failure outlasted the retry policy.
+	DeadLetter bool
+	// BatchSize is the number of words asked about in the same request, zero for single word requests.
+	BatchSize int
+	// Tags are the stage rules that fired for the word.
+	Tags []Tag
+	// TokensSaved estimates the answer tokens not generated because the answer was ended early or capped.
+	TokensSaved int
+}
+
+func IsWordRareOrObscure(ctx context.Context, backend llama.Backend, word string, options DetermineOptions) Determination {
 	logger := getLogger()
 
-	promptBase := "is this word obscure or uncommon, true or false? here is the word:"
-	//promptBase := "is this word rare, obscure, archaic or uncommon, true or false?  here is the word:"
-	request := &ollama.GenerateRequest{
-		Model:  "llama3.2",
-		Prompt: fmt.Sprintf("%s %s", promptBase, word),
+	definition := options.prompt()
+	request := llama.GenerateRequest{
+		Model:    options.model(),
+		System:   definition.System,
+		Subject:  word,
+		Template: definition.Version,
+		Format:   definition.schema,
+		Options:  options.promptOptions(),
+	}
+	promptVersion := definition.Version
+	if options.EarlyExit {
+		request.Until = verdictReady(options.Format)
+	}
+
+	determination := Determination{
+		Decision:      DecisionUndetermined,
+		Reason:        ReasonEmpty,
+		Model:         request.Model,
+		Prompt:        request.Prompt,
+		PromptVersion: promptVersion,
+	}
+
+	prompt, err := definition.render(word)
+	if err != nil {
+		logger.Warnf("word (%s), %s", word, err)
+		determination.Reason = ReasonUnparseable
+		determination.Err = err
+		return determination
+	}
+	request.Prompt = prompt
+	determination.Prompt = prompt
+
+	resp, err := backend.Generate(ctx, request)
+	if err != nil {
+		logger.Infof("failed to generate %s response for word (%s).  (%s)", backend.Name(), word, err)
+		determination.Reason = reasonForError(err)
+		determination.Err = err
+		return determination
+	}
+
+	determination.Response = resp.Response
+	determination.Metrics = resp.Metrics
+	if resp.Model != "" {
+		determination.Model = resp.Model
+	}
+	if resp.Stopped || (options.MaxTokens > 0 && resp.Metrics.EvalCount >= options.MaxTokens) {
+		determination.TokensSaved = max(options.ReferenceTokens-resp.Metrics.EvalCount, 0)
+	}
+
+	if options.Format == FormatJSON && options.EarlyExit {
+		determination.Verdict, determination.Decision, determination.Reason = parsePartialVerdictDecision(resp.Response, options.MinConfidence)
+	} else if options.Format == FormatJSON {
+		determination.Verdict, determination.Decision, determination.Reason = parseVerdictDecision(resp.Response, options.MinConfidence)
+	} else {
+		determination.Decision, determination.Reason = parseTextVerdict(resp.Response)
+	}
+
+	if determination.Reason != ReasonNone {
+		logger.Warnf("word (%s), invalid response (%s), reason (%s)", word, resp.Response, determination.Reason)
+		return determination
+	}
 
-		// set streaming to false
-		Stream: new(bool),
+	if options.Verbose {
+		fmt.Println(fmt.Sprintf("curated word (%s), decision (%s), response (%s)", word, determination.Decision, resp.Response))
+	} else {
+		logger.Debugf("curated word (%s), decision (%s), response (%s)", word, determination.Decision, resp.Response)
 	}
 
-	isRareOrObscure := false
-	response := ""
+	return determination
+}
 
-	respFunc := func(resp ollama.GenerateResponse) error {
-		parts := strings.Split(resp.Response, ".")
-		response = resp.Response
+// parseVerdictDecision decodes a json verdict and maps it to a decision, leaving low confidence verdicts undetermined.
+func parseVerdictDecision(response string, minConfidence float64) (*Verdict, Decision, UndeterminedReason) {
+	if strings.TrimSpace(response) == "" {
+		return nil, DecisionUndetermined, ReasonEmpty
+	}
 
-		boolResult := parts[0]
-		result, err := strconv.ParseBool(boolResult)
-		if err != nil {
-			logger.Warnf("word (%s), invalid response (%s)", word, resp.Response)
-			isRareOrObscure = false
-		} else {
-			isRareOrObscure = result
+	verdict, err := parseJSONVerdict(response)
+	if err != nil {
+		getLogger().Debugf("failed to parse verdict (%s).  (%s)", response, err)
+		return nil, DecisionUndetermined, ReasonUnparseable
+	}
 
-			if verbose {
-				fmt.Println(fmt.Sprintf("curated word (%s), result (%t), response (%s)", word, isRareOrObscure, resp.Response))
-			} else {
-				logger.Debugf("curated word (%s), result (%t), response (%s)", word, isRareOrObscure, resp.Response)
-			}
-		}
+	return verdictDecision(verdict, minConfidence)
+}
+
+// parsePartialVerdictDecision is parseVerdictDecision for an answer that may have been ended early.
+func parsePartialVerdictDecision(response string, minConfidence float64) (*Verdict, Decision, UndeterminedReason) {
+	if _, err := parseJSONVerdict(response); err == nil || strings.TrimSpace(response) == "" {
+		return parseVerdictDecision(response, minConfidence)
+	}
+
+	verdict, err := parsePartialVerdict(response)
+	if err != nil {
+		getLogger().Debugf("failed to parse partial verdict (%s).  (%s)", response, err)
+		return nil, DecisionUndetermined, ReasonUnparseable
+	}
+
+	return verdictDecision(verdict, minConfidence)
+}
+
+// verdictDecision maps a verdict to a decision, leaving verdicts below minConfidence undetermined.
+func verdictDecision(verdict Verdict, minConfidence float64) (*Verdict, Decision, UndeterminedReason) {
+	if verdict.Confidence < minConfidence {
+		return &verdict, DecisionUndetermined, ReasonLowConfidence
+	}
+
+	return &verdict, decisionFromBool(verdict.Obscure), ReasonNone
+}
 
-		return nil
+// parseTextVerdict reads the leading "True" or "False" sentence of a free text answer.
+func parseTextVerdict(response string) (Decision, UndeterminedReason) {
+	trimmed := strings.TrimSpace(response)
+	if trimmed == "" {
+		return DecisionUndetermined, ReasonEmpty
 	}
 
-	err := client.Generate(ctx, request, respFunc)
+	parts := strings.Split(trimmed, ".")
+	boolResult := strings.Trim(parts[0], " *\"'")
+	result, err := strconv.ParseBool(boolResult)
 	if err != nil {
-		logger.Infof("failed to generate ollama response for word (%s).  (%s)", word, err)
+		return DecisionUndetermined, ReasonUnparseable
 	}
 
-	return isRareOrObscure, response
+	return decisionFromBool(result), ReasonNone
 }
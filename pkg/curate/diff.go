@@ -0,0 +1,213 @@
+package curate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// unspecifiedReason is the flip reason when the excluding answer gives none, such as a free text answer.
+const unspecifiedReason = "unspecified"
+
+// Flip is a word curated in one run and excluded in the other.  Reasons say why the excluding run excluded it.
+type Flip struct {
+	Word         string   `json:"word"`
+	From         Decision `json:"from"`
+	To           Decision `json:"to"`
+	FromResponse string   `json:"from_response"`
+	ToResponse   string   `json:"to_response"`
+	Reasons      []string `json:"reasons"`
+}
+
+// FlipReason counts the flips in each direction for a reason.
+type FlipReason struct {
+	Reason        string `json:"reason"`
+	KeepToExclude int    `json:"keep_to_exclude"`
+	ExcludeToKeep int    `json:"exclude_to_keep"`
+}
+
+// RunDiff compares the decisions of two runs.
+type RunDiff struct {
+	Common           int          `json:"common"`
+	Unchanged        int          `json:"unchanged"`
+	KeepToExclude    int          `json:"keep_to_exclude"`
+	ExcludeToKeep    int          `json:"exclude_to_keep"`
+	ToUndetermined   int          `json:"to_undetermined"`
+	FromUndetermined int          `json:"from_undetermined"`
+	OtherChanges     int          `json:"other_changes"`
+	OnlyFrom         int          `json:"only_from"`
+	OnlyTo           int          `json:"only_to"`
+	Reasons          []FlipReason `json:"reasons"`
+	Flips            []Flip       `json:"flips"`
+}
+
+// ResolveRun returns the path of a run given as a path, or as the id of a run directory under runsDir.
+func ResolveRun(runsDir string, run string) string {
+	if _, err := os.Stat(run); err == nil {
+		return run
+	}
+	return filepath.Join(runsDir, run)
+}
+
+// RunManifestPath returns the manifest of a run, the path itself when it is a manifest or the manifest in a run dir.
+func RunManifestPath(path string) (string, bool) {
+	if filepath.Ext(path) == ".json" {
+		return path, true
+	}
+	manifestPath := filepath.Join(path, runManifestFile)
+	if _, err := os.Stat(manifestPath); err == nil {
+		return manifestPath, true
+	}
+	return "", false
+}
+
+// LoadRun reads the results of a run from a results file, from the results file named by a run manifest or the
+// manifest of a run directory, or from a directory holding the legacy curated, excluded and undetermined response files.
+func LoadRun(path string) (map[string]ResultRecord, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read run (%s). %w", path, err)
+	}
+
+	if manifestPath, found := RunManifestPath(path); found {
+		manifest, err := LoadRunManifest(manifestPath)
+		if err != nil {
+			return nil, err
+		}
+		// the results path is relative to the manifest
+		resultsPath := manifest.ResultsPath
+		if !filepath.IsAbs(resultsPath) {
+			resultsPath = filepath.Join(filepath.Dir(manifestPath), resultsPath)
+		}
+		return LoadResultRecords(resultsPath)
+	}
+
+	if info.IsDir() {
+		return loadLegacyRun(path)
+	}
+
+	return LoadResultRecords(path)
+}
+
+// loadLegacyRun reads the legacy response files in dir as result records with only a decision and a response.
+func loadLegacyRun(dir string) (map[string]ResultRecord, error) {
+	responses, err := readResponseFiles([]responseFile{
+		{filepath.Join(dir, "curated.response.txt"), DecisionKeep},
+		{filepath.Join(dir, "excluded.response.txt"), DecisionExclude},
+		{filepath.Join(dir, "undetermined.response.txt"), DecisionUndetermined},
+		{filepath.Join(dir, "guess-only.response.txt"), DecisionGuessOnly},
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(responses) == 0 {
+		return nil, fmt.Errorf("no response files in (%s)", dir)
+	}
+
+	records := make(map[string]ResultRecord, len(responses))
+	for word, legacy := range responses {
+		records[word] = ResultRecord{Word: word, Decision: legacy.decision, Response: legacy.response}
+	}
+	return records, nil
+}
+
+// DiffRuns compares the decisions of the words in both runs.  Flips are in word order, reasons by flip count.
+func DiffRuns(from map[string]ResultRecord, to map[string]ResultRecord) RunDiff {
+	diff := RunDiff{}
+	reasons := make(map[string]*FlipReason)
+
+	for word, a := range from {
+		b, found := to[word]
+		if !found {
+			diff.OnlyFrom++
+			continue
+		}
+		diff.Common++
+
+		switch {
+		case a.Decision == b.Decision:
+			diff.Unchanged++
+			continue
+		case a.Decision == DecisionKeep && b.Decision == DecisionExclude:
+			diff.KeepToExclude++
+		case a.Decision == DecisionExclude && b.Decision == DecisionKeep:
+			diff.ExcludeToKeep++
+		case b.Decision == DecisionUndetermined:
+			diff.ToUndetermined++
+			continue
+		case a.Decision == DecisionUndetermined:
+			diff.FromUndetermined++
+			continue
+		default:
+			diff.OtherChanges++
+			continue
+		}
+
+		excluding := b
+		if b.Decision == DecisionKeep {
+			excluding = a
+		}
+		flip := Flip{Word: word, From: a.Decision, To: b.Decision, FromResponse: a.Response, ToResponse: b.Response, Reasons: exclusionReasons(excluding)}
+		diff.Flips = append(diff.Flips, flip)
+
+		for _, reason := range flip.Reasons {
+			r, found := reasons[reason]
+			if !found {
+				r = &FlipReason{Reason: reason}
+				reasons[reason] = r
+			}
+			if flip.To == DecisionExclude {
+				r.KeepToExclude++
+			} else {
+				r.ExcludeToKeep++
+			}
+		}
+	}
+
+	for word := range to {
+		if _, found := from[word]; !found {
+			diff.OnlyTo++
+		}
+	}
+
+	slices.SortFunc(diff.Flips, func(a, b Flip) int { return strings.Compare(a.Word, b.Word) })
+	for _, reason := range reasons {
+		diff.Reasons = append(diff.Reasons, *reason)
+	}
+	slices.SortFunc(diff.Reasons, func(a, b FlipReason) int {
+		if n := (b.KeepToExclude + b.ExcludeToKeep) - (a.KeepToExclude + a.ExcludeToKeep); n != 0 {
+			return n
+		}
+		return strings.Compare(a.Reason, b.Reason)
+	})
+
+	return diff
+}
+
+// exclusionReasons says why a record was excluded: an override, the verdict's reason codes, or the stage rules that
+// fired.
+func exclusionReasons(record ResultRecord) []string {
+	if record.Override != nil {
+		return []string{overrideStage}
+	}
+
+	if record.Verdict != nil && len(record.Verdict.Reasons) > 0 {
+		reasons := make([]string, len(record.Verdict.Reasons))
+		for i, reason := range record.Verdict.Reasons {
+			reasons[i] = string(reason)
+		}
+		return reasons
+	}
+
+	if len(record.Tags) > 0 {
+		reasons := make([]string, len(record.Tags))
+		for i, tag := range record.Tags {
+			reasons[i] = tag.Stage + ":" + tag.Rule
+		}
+		return reasons
+	}
+
+	return []string{unspecifiedReason}
+}
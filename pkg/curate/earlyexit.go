@@ -0,0 +1,75 @@
+package curate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	// defaultReferenceTokens is roughly the length of a full answer with its explanation, the legacy responses average
+	// about 60 tokens.
+	defaultReferenceTokens = 60
+
+	// textVerdictLimit ends a text answer that hasn't finished its first sentence by then, it won't parse anyway.
+	textVerdictLimit = 64
+)
+
+var (
+	errPartialVerdict = errors.New("partial verdict is missing obscure, confidence or reasons")
+
+	partialObscurePattern    = regexp.MustCompile(`"obscure"\s*:\s*(true|false)`)
+	partialConfidencePattern = regexp.MustCompile(`"confidence"\s*:\s*(-?[0-9.]+(?:[eE][-+]?[0-9]+)?)\s*[,}]`)
+	partialReasonsPattern    = regexp.MustCompile(`"reasons"\s*:\s*(\[[^\]]*\])`)
+	partialDefinitionPattern = regexp.MustCompile(`"definition"\s*:\s*("(?:[^"\\]|\\.)*")`)
+)
+
+// verdictReady returns the Until func ending a streamed answer once its verdict parses.
+func verdictReady(format ResponseFormat) func(response string) bool {
+	if format == FormatJSON {
+		return func(response string) bool {
+			_, err := parsePartialVerdict(response)
+			return err == nil
+		}
+	}
+
+	return func(response string) bool {
+		trimmed := strings.TrimSpace(response)
+		return strings.Contains(trimmed, ".") || len(trimmed) > textVerdictLimit
+	}
+}
+
+// parsePartialVerdict reads obscure, confidence and reasons from a json answer that was ended early, in whichever order
+// the model produced them.  The definition is kept when it was complete, otherwise it is left empty.
+func parsePartialVerdict(response string) (Verdict, error) {
+	obscure := partialObscurePattern.FindStringSubmatch(response)
+	confidence := partialConfidencePattern.FindStringSubmatch(response)
+	reasons := partialReasonsPattern.FindStringSubmatch(response)
+	if obscure == nil || confidence == nil || reasons == nil {
+		return Verdict{}, errPartialVerdict
+	}
+
+	value, err := strconv.ParseFloat(confidence[1], 64)
+	if err != nil || value < 0 || value > 1 {
+		return Verdict{}, errPartialVerdict
+	}
+
+	verdict := Verdict{Obscure: obscure[1] == "true", Confidence: value, Reasons: []ReasonCode{}}
+	if err := json.Unmarshal([]byte(reasons[1]), &verdict.Reasons); err != nil {
+		return Verdict{}, fmt.Errorf("invalid partial verdict reasons. %w", err)
+	}
+	for _, reason := range verdict.Reasons {
+		if !slices.Contains(reasonCodes, reason) {
+			return Verdict{}, fmt.Errorf("partial verdict reason (%s) is not a known reason code", reason)
+		}
+	}
+
+	if definition := partialDefinitionPattern.FindStringSubmatch(response); definition != nil {
+		json.Unmarshal([]byte(definition[1]), &verdict.Definition)
+	}
+	return verdict, nil
+}
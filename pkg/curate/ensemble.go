@@ -0,0 +1,252 @@
+package curate
+
+import (
+	"context"
+	"fmt"
+	"ozzysoft.net/wordle/pkg/llama"
+	"strings"
+)
+
+// Voter is a model taking part in an ensemble.
+type Voter struct {
+	Model       string  `yaml:"model"`
+	Samples     int     `yaml:"samples"`
+	Temperature float64 `yaml:"temperature"`
+	Seed        int     `yaml:"seed"`
+	Weight      float64 `yaml:"weight"`
+}
+
+type EnsembleConfig struct {
+	Voters []Voter `yaml:"voters"`
+	// Policy names the aggregation policy: majority, unanimous or weighted.
+	Policy string `yaml:"policy"`
+}
+
+// Vote is one voter sample's answer for a word.
+type Vote struct {
+	Model      string             `json:"model"`
+	Seed       int                `json:"seed"`
+	Weight     float64            `json:"weight"`
+	Decision   Decision           `json:"decision"`
+	Reason     UndeterminedReason `json:"reason,omitempty"`
+	Confidence *float64           `json:"confidence,omitempty"`
+	Response   string             `json:"response"`
+	Error      string             `json:"error,omitempty"`
+}
+
+// AggregationPolicy turns the votes for a word into a single decision.
+type AggregationPolicy interface {
+	Name() string
+	Aggregate(votes []Vote) (Decision, UndeterminedReason)
+}
+
+// ReasonNoConsensus is an ensemble that could not settle on a decision.
+const ReasonNoConsensus UndeterminedReason = "no_consensus"
+
+func NewAggregationPolicy(name string) (AggregationPolicy, error) {
+	switch name {
+	case "", "majority":
+		return MajorityPolicy{}, nil
+	case "unanimous":
+		return UnanimousExcludePolicy{}, nil
+	case "weighted":
+		return WeightedPolicy{}, nil
+	default:
+		return nil, fmt.Errorf("unknown aggregation policy (%s)", name)
+	}
+}
+
+// MajorityPolicy takes the decision with the most votes, a tie is undetermined.
+type MajorityPolicy struct{}
+
+func (MajorityPolicy) Name() string {
+	return "majority"
+}
+
+func (MajorityPolicy) Aggregate(votes []Vote) (Decision, UndeterminedReason) {
+	return weigh(votes, func(Vote) float64 { return 1 })
+}
+
+// WeightedPolicy sums the voter weights for each decision.
+type WeightedPolicy struct{}
+
+func (WeightedPolicy) Name() string {
+	return "weighted"
+}
+
+func (WeightedPolicy) Aggregate(votes []Vote) (Decision, UndeterminedReason) {
+	return weigh(votes, func(v Vote) float64 { return v.Weight })
+}
+
+// UnanimousExcludePolicy excludes a word only when every vote is to exclude, any keep vote keeps it.
+type UnanimousExcludePolicy struct{}
+
+func (UnanimousExcludePolicy) Name() string {
+	return "unanimous"
+}
+
+func (UnanimousExcludePolicy) Aggregate(votes []Vote) (Decision, UndeterminedReason) {
+	if len(votes) == 0 {
+		return DecisionUndetermined, ReasonEmpty
+	}
+
+	for _, vote := range votes {
+		if vote.Decision == DecisionKeep {
+			return DecisionKeep, ReasonNone
+		}
+	}
+	for _, vote := range votes {
+		if vote.Decision == DecisionUndetermined {
+			return DecisionUndetermined, vote.Reason
+		}
+	}
+	return DecisionExclude, ReasonNone
+}
+
+func weigh(votes []Vote, weight func(Vote) float64) (Decision, UndeterminedReason) {
+	keep, exclude := 0.0, 0.0
+	reason := ReasonEmpty
+	for _, vote := range votes {
+		switch vote.Decision {
+		case DecisionKeep:
+			keep += weight(vote)
+		case DecisionExclude:
+			exclude += weight(vote)
+		default:
+			reason = vote.Reason
+		}
+	}
+
+	switch {
+	case keep == 0 && exclude == 0:
+		return DecisionUndetermined, reason
+	case keep > exclude:
+		return DecisionKeep, ReasonNone
+	case exclude > keep:
+		return DecisionExclude, ReasonNone
+	default:
+		return DecisionUndetermined, ReasonNoConsensus
+	}
+}
+
+// isDisagreement returns true when the decided votes are split between keep and exclude.
+func isDisagreement(votes []Vote) bool {
+	keep, exclude := false, false
+	for _, vote := range votes {
+		keep = keep || vote.Decision == DecisionKeep
+		exclude = exclude || vote.Decision == DecisionExclude
+	}
+	return keep && exclude
+}
+
+type voterSample struct {
+	voter   Voter
+	seed    int
+	options DetermineOptions
+}
+
+// EnsembleClassifier asks every voter sample about a word in turn and aggregates the votes with the policy.
+type EnsembleClassifier struct {
+	backend llama.Backend
+	samples []voterSample
+	policy  AggregationPolicy
+	retry   RetryPolicy
+}
+
+func NewEnsembleClassifier(backend llama.Backend, config EnsembleConfig, options DetermineOptions, retry RetryPolicy) (*EnsembleClassifier, error) {
+	policy, err := NewAggregationPolicy(config.Policy)
+	if err != nil {
+		return nil, err
+	}
+
+	samples := make([]voterSample, 0, len(config.Voters))
+	for _, voter := range config.Voters {
+		if voter.Model == "" {
+			return nil, fmt.Errorf("ensemble voter is missing a model")
+		}
+		voter.Samples = max(voter.Samples, 1)
+		if voter.Weight == 0 {
+			voter.Weight = 1
+		}
+
+		for i := range voter.Samples {
+			seed := voter.Seed + i
+			temperature := voter.Temperature
+			sampleOptions := options
+			sampleOptions.Model = voter.Model
+			sampleOptions.Temperature = &temperature
+			sampleOptions.Seed = &seed
+			samples = append(samples, voterSample{voter: voter, seed: seed, options: sampleOptions})
+		}
+	}
+
+	getLogger().Infof("ensemble classifier, policy (%s), voter samples (%d)", policy.Name(), len(samples))
+	return &EnsembleClassifier{backend: backend, samples: samples, policy: policy, retry: retry}, nil
+}
+
+func (c *EnsembleClassifier) Classify(ctx context.Context, word string) Determination {
+	votes := make([]Vote, 0, len(c.samples))
+	determinations := make([]Determination, 0, len(c.samples))
+	models := make([]string, 0, len(c.samples))
+
+	for _, sample := range c.samples {
+		determination := determineWithRetry(ctx, c.retry, word, func(ctx context.Context) Determination {
+			return IsWordRareOrObscure(ctx, c.backend, word, sample.options)
+		})
+		determinations = append(determinations, determination)
+		votes = append(votes, newVote(sample, determination))
+		models = append(models, fmt.Sprintf("%s#%d", sample.voter.Model, sample.seed))
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	decision, reason := c.policy.Aggregate(votes)
+
+	// the representative determination supplies the response and verdict, it is the first vote matching the decision
+	aggregate := determinations[0]
+	for _, determination := range determinations {
+		if determination.Decision == decision {
+			aggregate = determination
+			break
+		}
+	}
+
+	aggregate.Decision = decision
+	aggregate.Reason = reason
+	aggregate.Model = strings.Join(models, ",")
+	aggregate.Votes = votes
+	aggregate.Policy = c.policy.Name()
+	aggregate.Metrics = llama.Metrics{}
+	aggregate.Attempts = 0
+	aggregate.TokensSaved = 0
+	aggregate.DeadLetter = false
+	for _, determination := range determinations {
+		aggregate.Metrics = aggregate.Metrics.Add(determination.Metrics)
+		aggregate.Attempts += determination.Attempts
+		aggregate.TokensSaved += determination.TokensSaved
+		aggregate.DeadLetter = aggregate.DeadLetter || (decision == DecisionUndetermined && determination.DeadLetter)
+	}
+
+	return aggregate
+}
+
+func newVote(sample voterSample, determination Determination) Vote {
+	vote := Vote{
+		Model:    sample.voter.Model,
+		Seed:     sample.seed,
+		Weight:   sample.voter.Weight,
+		Decision: determination.Decision,
+		Reason:   determination.Reason,
+		Response: determination.Response,
+	}
+	if determination.Verdict != nil {
+		confidence := determination.Verdict.Confidence
+		vote.Confidence = &confidence
+	}
+	if determination.Err != nil {
+		vote.Error = determination.Err.Error()
+	}
+	return vote
+}
@@ -0,0 +1,30 @@
+package curate
+
+import (
+	"testing"
+)
+
+func TestUnanimousExcludePolicy(t *testing.T) {
+	keep := Vote{Decision: DecisionKeep}
+	exclude := Vote{Decision: DecisionExclude}
+	undetermined := Vote{Decision: DecisionUndetermined, Reason: ReasonUnparseable}
+
+	for _, c := range []struct {
+		votes    []Vote
+		decision Decision
+		reason   UndeterminedReason
+	}{
+		{[]Vote{exclude, exclude}, DecisionExclude, ReasonNone},
+		{[]Vote{exclude, keep}, DecisionKeep, ReasonNone},
+		{[]Vote{undetermined, keep}, DecisionKeep, ReasonNone},
+		{[]Vote{keep, undetermined}, DecisionKeep, ReasonNone},
+		{[]Vote{exclude, undetermined}, DecisionUndetermined, ReasonUnparseable},
+		{[]Vote{undetermined, exclude}, DecisionUndetermined, ReasonUnparseable},
+		{nil, DecisionUndetermined, ReasonEmpty},
+	} {
+		decision, reason := UnanimousExcludePolicy{}.Aggregate(c.votes)
+		if decision != c.decision || reason != c.reason {
+			t.Errorf("votes (%v) aggregated to (%s, %s), expected (%s, %s)", c.votes, decision, reason, c.decision, c.reason)
+		}
+	}
+}
@@ -0,0 +1,359 @@
+package curate
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"ozzysoft.net/wordle/pkg/llama"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// GoldWord is a hand labeled word, Expected is keep or exclude.
+type GoldWord struct {
+	Word     string   `json:"word"`
+	Expected Decision `json:"decision"`
+}
+
+// LoadGoldSet reads a labeled word set, a csv file of word,decision rows (an optional header is skipped) or a jsonl file
+// of {"word": ..., "decision": ...} objects.  Decisions are keep or exclude, curated and excluded are also accepted.
+func LoadGoldSet(path string) ([]GoldWord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open gold set (%s). %w", path, err)
+	}
+	defer doClose(f)
+
+	var gold []GoldWord
+	if strings.EqualFold(filepath.Ext(path), ".jsonl") {
+		gold, err = readGoldJSONL(f)
+	} else {
+		gold, err = readGoldCSV(f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read gold set (%s). %w", path, err)
+	}
+
+	seen := make(map[string]bool, len(gold))
+	unique := gold[:0]
+	for _, g := range gold {
+		if seen[g.Word] {
+			getLogger().Warnf("gold set (%s) repeats word (%s), keeping the first label", path, g.Word)
+			continue
+		}
+		seen[g.Word] = true
+		unique = append(unique, g)
+	}
+
+	if len(unique) == 0 {
+		return nil, fmt.Errorf("gold set (%s) has no words", path)
+	}
+	return unique, nil
+}
+
+func readGoldCSV(r io.Reader) ([]GoldWord, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var gold []GoldWord
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return gold, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 2 {
+			return nil, fmt.Errorf("line (%d) needs a word and a decision", line)
+		}
+
+		expected, err := parseGoldDecision(record[1])
+		if err != nil {
+			if line == 1 {
+				// header
+				continue
+			}
+			return nil, fmt.Errorf("line (%d). %w", line, err)
+		}
+		gold = append(gold, GoldWord{Word: normalizeWord(record[0]), Expected: expected})
+	}
+}
+
+func readGoldJSONL(r io.Reader) ([]GoldWord, error) {
+	var gold []GoldWord
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var raw struct {
+			Word     string `json:"word"`
+			Decision string `json:"decision"`
+		}
+		if err := json.Unmarshal([]byte(text), &raw); err != nil {
+			return nil, fmt.Errorf("line (%d). %w", line, err)
+		}
+		expected, err := parseGoldDecision(raw.Decision)
+		if err != nil {
+			return nil, fmt.Errorf("line (%d). %w", line, err)
+		}
+		gold = append(gold, GoldWord{Word: normalizeWord(raw.Word), Expected: expected})
+	}
+	return gold, scanner.Err()
+}
+
+func parseGoldDecision(s string) (Decision, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "keep", "curated", "common":
+		return DecisionKeep, nil
+	case "exclude", "excluded", "obscure":
+		return DecisionExclude, nil
+	}
+	return "", fmt.Errorf("unknown gold decision (%s)", s)
+}
+
+func normalizeWord(word string) string {
+	return strings.ToLower(strings.TrimSpace(word))
+}
+
+// EvalMiss is a gold word the configuration got wrong.
+type EvalMiss struct {
+	Word     string   `json:"word"`
+	Expected Decision `json:"expected"`
+	Actual   Decision `json:"actual"`
+	Reason   string   `json:"reason,omitempty"`
+	Response string   `json:"response"`
+}
+
+// EvalReport scores a configuration against a gold set.
+type EvalReport struct {
+	Name             string                        `json:"name"`
+	GoldPath         string                        `json:"gold_path"`
+	Prompt           string                        `json:"prompt"`
+	PromptVersion    string                        `json:"prompt_version"`
+	Model            string                        `json:"model"`
+	Options          map[string]interface{}        `json:"options,omitempty"`
+	BatchSize        int                           `json:"batch_size"`
+	Words            int                           `json:"words"`
+	Interrupted      bool                          `json:"interrupted,omitempty"`
+	Accuracy         float64                       `json:"accuracy"`
+	Precision        float64                       `json:"precision"`
+	Recall           float64                       `json:"recall"`
+	F1               float64                       `json:"f1"`
+	Confusion        map[Decision]map[Decision]int `json:"confusion"`
+	ParseFailures    int                           `json:"parse_failures"`
+	ParseFailureRate float64                       `json:"parse_failure_rate"`
+	Errors           int                           `json:"errors"`
+	LatencyMeanMs    float64                       `json:"latency_mean_ms"`
+	LatencyP50Ms     float64                       `json:"latency_p50_ms"`
+	LatencyP95Ms     float64                       `json:"latency_p95_ms"`
+	ElapsedMs        float64                       `json:"elapsed_ms"`
+	Misses           []EvalMiss                    `json:"misses"`
+	Timestamp        time.Time                     `json:"timestamp"`
+}
+
+// Evaluate curates the gold words with the configuration, through the same workers and classifiers as Curate but
+// without the journal and outputs, and scores the decisions.  A cancelled evaluation scores the words done so far.
+func Evaluate(ctx context.Context, backend llama.Backend, config Config, gold []GoldWord) (EvalReport, error) {
+	if err := config.resolvePrompts(); err != nil {
+		return EvalReport{}, err
+	}
+
+	words := make([]string, len(gold))
+	for i, g := range gold {
+		words[i] = g.Word
+	}
+
+	start := time.Now()
+	results, interrupted, err := classifyWords(ctx, backend, config, &RunStats{}, words)
+	if err != nil {
+		return EvalReport{}, err
+	}
+	if interrupted {
+		getLogger().Warnf("evaluation interrupted, scoring classified words (%d) of (%d)", len(results), len(words))
+	}
+
+	prompt := config.Determine.prompt()
+	report := scoreResults(gold, results)
+	report.Interrupted = interrupted
+	report.Prompt = prompt.Name
+	report.PromptVersion = prompt.Version
+	report.Model = config.Determine.model()
+	report.Options = config.Determine.promptOptions()
+	report.BatchSize = max(config.Batch.Size, 1)
+	report.ElapsedMs = milliseconds(time.Since(start))
+	report.Timestamp = time.Now()
+	report.Name = fmt.Sprintf("%s@%s/batch%d", report.PromptVersion, report.Model, report.BatchSize)
+	return report, nil
+}
+
+// scoreResults compares the results with the gold labels.
+func scoreResults(gold []GoldWord, results []CurateResult) EvalReport {
+	byWord := make(map[string]CurateResult, len(results))
+	for _, result := range results {
+		byWord[result.word] = result
+	}
+
+	report := EvalReport{Confusion: make(map[Decision]map[Decision]int)}
+	for _, expected := range []Decision{DecisionKeep, DecisionExclude} {
+		report.Confusion[expected] = map[Decision]int{DecisionKeep: 0, DecisionExclude: 0, DecisionUndetermined: 0}
+	}
+
+	var latencies []float64
+	correct, truePositive, falsePositive, falseNegative := 0, 0, 0, 0
+	for _, g := range gold {
+		result, found := byWord[g.Word]
+		if !found {
+			// the run was interrupted before the word was curated
+			continue
+		}
+
+		report.Words++
+		report.Confusion[g.Expected][result.decision]++
+		latencies = append(latencies, milliseconds(result.latency))
+
+		if result.reason == ReasonUnparseable || result.reason == ReasonEmpty {
+			report.ParseFailures++
+		}
+		if result.err != nil {
+			report.Errors++
+		}
+
+		switch {
+		case result.decision == g.Expected:
+			correct++
+			if g.Expected == DecisionExclude {
+				truePositive++
+			}
+		default:
+			if result.decision == DecisionExclude {
+				falsePositive++
+			}
+			if g.Expected == DecisionExclude {
+				falseNegative++
+			}
+			report.Misses = append(report.Misses, EvalMiss{Word: g.Word, Expected: g.Expected, Actual: result.decision, Reason: string(result.reason), Response: result.response})
+		}
+	}
+
+	report.Accuracy = ratio(correct, report.Words)
+	report.Precision = ratio(truePositive, truePositive+falsePositive)
+	report.Recall = ratio(truePositive, truePositive+falseNegative)
+	if report.Precision+report.Recall > 0 {
+		report.F1 = 2 * report.Precision * report.Recall / (report.Precision + report.Recall)
+	}
+	report.ParseFailureRate = ratio(report.ParseFailures, report.Words)
+
+	if len(latencies) > 0 {
+		total := 0.0
+		for _, latency := range latencies {
+			total += latency
+		}
+		slices.Sort(latencies)
+		report.LatencyMeanMs = total / float64(len(latencies))
+		report.LatencyP50Ms = percentile(latencies, 0.5)
+		report.LatencyP95Ms = percentile(latencies, 0.95)
+	}
+
+	return report
+}
+
+func ratio(n int, d int) float64 {
+	if d == 0 {
+		return 0
+	}
+	return float64(n) / float64(d)
+}
+
+// percentile of sorted values, nearest rank.
+func percentile(sorted []float64, p float64) float64 {
+	i := int(p*float64(len(sorted))+0.5) - 1
+	return sorted[min(max(i, 0), len(sorted)-1)]
+}
+
+// WriteEvalReport writes the report as indented json.
+func WriteEvalReport(path string, report EvalReport) error {
+	return writeJSONFile(path, report)
+}
+
+// writeJSONFile writes v as indented json, through a temporary file so an interrupted write leaves no partial file.
+func writeJSONFile(path string, v any) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal (%s). %w", path, err)
+	}
+	return writeFileAtomic(path, append(b, '\n'))
+}
+
+// LoadEvalReport reads a report written by WriteEvalReport.
+func LoadEvalReport(path string) (EvalReport, error) {
+	var report EvalReport
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return report, fmt.Errorf("failed to read eval report (%s). %w", path, err)
+	}
+	if err := json.Unmarshal(b, &report); err != nil {
+		return report, fmt.Errorf("failed to unmarshal eval report (%s). %w", path, err)
+	}
+	return report, nil
+}
+
+// RankEvalReports orders reports best first: by f1 for exclude, then accuracy, then fewer parse failures, then latency.
+func RankEvalReports(reports []EvalReport) {
+	slices.SortStableFunc(reports, func(a, b EvalReport) int {
+		for _, d := range []float64{b.F1 - a.F1, b.Accuracy - a.Accuracy, a.ParseFailureRate - b.ParseFailureRate, a.LatencyMeanMs - b.LatencyMeanMs} {
+			if d < 0 {
+				return -1
+			}
+			if d > 0 {
+				return 1
+			}
+		}
+		return 0
+	})
+}
+
+// classifyWords curates words without the journal and outputs.
+func classifyWords(ctx context.Context, backend llama.Backend, config Config, stats *RunStats, words []string) ([]CurateResult, bool, error) {
+	resultChannel := make(chan CurateResult, 100)
+	wordChannel := make(chan string, 100)
+	if _, err := startWorkers(ctx, backend, config, stats, wordChannel, resultChannel); err != nil {
+		return nil, false, err
+	}
+
+	go func() {
+		defer close(wordChannel)
+		for _, word := range words {
+			select {
+			case wordChannel <- word:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	results := make([]CurateResult, 0, len(words))
+	for {
+		select {
+		case <-ctx.Done():
+			return results, true, nil
+		case result := <-resultChannel:
+			if result.done {
+				return results, false, nil
+			}
+			stats.record(result)
+			results = append(results, result)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package curate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"ozzysoft.net/wordle/pkg/llama"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testGold = []GoldWord{
+	{Word: "abbey", Expected: DecisionKeep},
+	{Word: "aahed", Expected: DecisionExclude},
+	{Word: "zzzzz", Expected: DecisionExclude},
+	{Word: "cable", Expected: DecisionExclude},
+}
+
+func TestEvaluate(t *testing.T) {
+	config := testConfig(t)
+	report, err := Evaluate(context.Background(), llama.NewFakeBackend(newFakeAnswers(testAnswers).respond), config, testGold)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Words != 4 || report.Interrupted || report.Accuracy != 0.5 || report.ParseFailures != 1 {
+		t.Errorf("report has words (%d), interrupted (%t), accuracy (%f), parse failures (%d)", report.Words, report.Interrupted, report.Accuracy, report.ParseFailures)
+	}
+	if report.Confusion[DecisionExclude][DecisionKeep] != 1 || report.Confusion[DecisionExclude][DecisionUndetermined] != 1 {
+		t.Errorf("report has confusion (%v)", report.Confusion)
+	}
+}
+
+func TestEvaluateBatch(t *testing.T) {
+	// a batched and a single word evaluation of the same gold words are told apart in the reports
+	var reports []EvalReport
+	for _, size := range []int{1, 3} {
+		config := testConfig(t)
+		config.Determine.Format = FormatJSON
+		config.Batch.Size = size
+		report, err := Evaluate(context.Background(), llama.NewFakeBackend(nil), config, testGold)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Words != len(testGold) || report.BatchSize != size {
+			t.Errorf("batch size (%d) report has words (%d), batch size (%d)", size, report.Words, report.BatchSize)
+		}
+		reports = append(reports, report)
+	}
+
+	if reports[0].Name == reports[1].Name {
+		t.Errorf("single word and batched reports have the same name (%s)", reports[0].Name)
+	}
+}
+
+func TestEvaluateInterrupted(t *testing.T) {
+	config := testConfig(t)
+	config.MaxConcurrency = 1
+
+	gold := make([]GoldWord, 200)
+	for i := range gold {
+		gold[i] = GoldWord{Word: fmt.Sprintf("w%03d", i), Expected: DecisionKeep}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	answered := atomic.Int64{}
+	answers := newFakeAnswers(testAnswers)
+	backend := llama.NewFakeBackend(func(request llama.GenerateRequest) string {
+		if answered.Add(1) == 20 {
+			cancel()
+		}
+		return answers.respond(request)
+	})
+
+	report, err := Evaluate(ctx, backend, config, gold)
+	if err != nil {
+		t.Fatalf("interrupted evaluation failed. %s", err)
+	}
+	if !report.Interrupted || report.Words >= len(gold) {
+		t.Errorf("report has interrupted (%t), words (%d) of (%d)", report.Interrupted, report.Words, len(gold))
+	}
+}
+
+// stallingBackend holds every generate request until the context is cancelled, which it does once enough are waiting.
+type stallingBackend struct {
+	*llama.FakeBackend
+	cancel  context.CancelFunc
+	waiting atomic.Int64
+	stall   int64
+}
+
+func (b *stallingBackend) Generate(ctx context.Context, request llama.GenerateRequest) (llama.GenerateResponse, error) {
+	if b.waiting.Add(1) == b.stall {
+		b.cancel()
+	}
+	<-ctx.Done()
+	return b.FakeBackend.Generate(context.Background(), request)
+}
+
+func TestEvaluateInterruptedReleasesWorkers(t *testing.T) {
+	// more words are in flight than the result channels hold, none may be left blocked sending once evaluation stops
+	for _, cascade := range []bool{false, true} {
+		config := testConfig(t)
+		config.MaxConcurrency = 300
+		config.Retry.MaxAttempts = 1
+		if cascade {
+			config.Cascade.Enabled = true
+			config.Cascade.Fast.Determine.Model = "fast"
+			config.Cascade.Fast.MaxConcurrency = 300
+			config.Cascade.Strong.Determine.Model = "strong"
+			config.Cascade.Strong.MaxConcurrency = 300
+		}
+
+		gold := make([]GoldWord, 400)
+		for i := range gold {
+			gold[i] = GoldWord{Word: fmt.Sprintf("w%03d", i), Expected: DecisionKeep}
+		}
+
+		before := runtime.NumGoroutine()
+		ctx, cancel := context.WithCancel(context.Background())
+		backend := &stallingBackend{FakeBackend: llama.NewFakeBackend(newFakeAnswers(testAnswers).respond), cancel: cancel, stall: 300}
+		report, err := Evaluate(ctx, backend, config, gold)
+		cancel()
+		if err != nil {
+			t.Fatalf("cascade (%t) interrupted evaluation failed. %s", cascade, err)
+		}
+		if !report.Interrupted {
+			t.Errorf("cascade (%t) report isn't interrupted", cascade)
+		}
+
+		deadline := time.Now().Add(5 * time.Second)
+		for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if remaining := runtime.NumGoroutine(); remaining > before {
+			t.Errorf("cascade (%t) left goroutines (%d), started with (%d)", cascade, remaining, before)
+		}
+	}
+}
+
+func TestSweepResume(t *testing.T) {
+	config := testConfig(t, "abbey", "aahed", "zzzzz", "cable")
+	config.Sweep.Models = []string{"first", "second"}
+	config.Sweep.SampleSize = 0
+	config.Sweep.Dir = filepath.Join(t.TempDir(), "sweep")
+	// the model keeps cable, which the reference excluded, and has no answer for the unlabeled zzzzz
+	if err := os.WriteFile(config.CuratedPath, []byte("abbey\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(config.ExcludedPath, []byte("aahed\ncable\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mu := sync.Mutex{}
+	requests := make(map[string]int)
+	answers := newFakeAnswers(testAnswers)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	backend := llama.NewFakeBackend(func(request llama.GenerateRequest) string {
+		mu.Lock()
+		defer mu.Unlock()
+		requests[request.Model]++
+		if request.Model == "second" {
+			cancel()
+		}
+		return answers.respond(request)
+	})
+
+	// the sweep is interrupted in the second cell, only the first is written
+	if _, err := Sweep(ctx, backend, config); !errors.Is(err, context.Canceled) {
+		t.Fatalf("interrupted sweep returned (%v), expected it cancelled", err)
+	}
+
+	clear(requests)
+	results, err := Sweep(context.Background(), backend, config)
+	if err != nil {
+		t.Fatalf("resumed sweep failed. %s", err)
+	}
+	if requests["first"] != 0 || requests["second"] != 4 {
+		t.Errorf("resumed sweep asked (%v), expected only the second cell's words", requests)
+	}
+	if len(results) != 2 {
+		t.Fatalf("sweep has results (%d), expected (2)", len(results))
+	}
+	for _, result := range results {
+		if result.Labeled != 3 || result.Agreement != 2.0/3 || result.Report.ParseFailures != 1 {
+			t.Errorf("cell (%s) has labeled (%d), agreement (%f), parse failures (%d)", result.Cell.ID(), result.Labeled, result.Agreement, result.Report.ParseFailures)
+		}
+	}
+
+	// a different sample is a different run, every cell runs again
+	clear(requests)
+	config.Sweep.SampleSize = 3
+	if _, err := Sweep(context.Background(), backend, config); err != nil {
+		t.Fatalf("resampled sweep failed. %s", err)
+	}
+	if requests["first"] != 3 || requests["second"] != 3 {
+		t.Errorf("resampled sweep asked (%v), expected every cell to run again", requests)
+	}
+}
@@ -0,0 +1,104 @@
+package curate
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// JournalEntry records a single processed word, the last entry for a word wins.
+type JournalEntry struct {
+	Word     string    `json:"word"`
+	Decision Decision  `json:"decision"`
+	Override bool      `json:"override,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+type Journal struct {
+	file *os.File
+}
+
+// LoadJournal reads the processed words from the journal at path.
+func LoadJournal(path string) (map[string]JournalEntry, error) {
+	entries := make(map[string]JournalEntry)
+
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return entries, nil
+		}
+		return nil, fmt.Errorf("failed to open journal (%s). %w", path, err)
+	}
+	defer doClose(f)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var entry JournalEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			getLogger().Warnf("skipping invalid journal line (%s). (%s)", line, err)
+			continue
+		}
+		entries[entry.Word] = entry
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read journal (%s). %w", path, err)
+	}
+
+	return entries, nil
+}
+
+// OpenJournal opens the journal for appending, truncating it first when fresh is set.
+func OpenJournal(path string, fresh bool) (*Journal, error) {
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if fresh {
+		flags |= os.O_TRUNC
+	}
+
+	f, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal (%s). %w", path, err)
+	}
+
+	return &Journal{file: f}, nil
+}
+
+// Record appends the result to the journal and syncs it to disk.
+func (j *Journal) Record(result CurateResult) error {
+	return j.record(JournalEntry{Word: result.word, Decision: result.decision, Override: result.override != nil})
+}
+
+func (j *Journal) record(entry JournalEntry) error {
+	return j.recordAll([]JournalEntry{entry})
+}
+
+// recordAll appends the entries with a single sync.
+func (j *Journal) recordAll(entries []JournalEntry) error {
+	var b []byte
+	for _, entry := range entries {
+		entry.Time = time.Now()
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("failed to marshal journal entry for word (%s). %w", entry.Word, err)
+		}
+		b = append(append(b, line...), '\n')
+	}
+
+	if _, err := j.file.Write(b); err != nil {
+		return fmt.Errorf("failed to write journal entries (%d). %w", len(entries), err)
+	}
+
+	return j.file.Sync()
+}
+
+func (j *Journal) Close() {
+	doClose(j.file)
+}
@@ -0,0 +1,187 @@
+package curate
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limiter bounds the number of words being curated at once.
+type Limiter interface {
+	// Acquire blocks until a word may start, it returns false when the context is done first.
+	Acquire(ctx context.Context) bool
+	// Release ends a word, with the latency and failure that adaptive limiters learn from.
+	Release(latency time.Duration, failed bool)
+	Limit() int
+	// Adjustments returns the number of times the limit has been raised and lowered.
+	Adjustments() (int64, int64)
+}
+
+// ConcurrencyConfig selects the adaptive limiter or the fixed MaxConcurrency.
+type ConcurrencyConfig struct {
+	Adaptive         bool    `yaml:"adaptive"`
+	Min              int     `yaml:"min"`
+	Max              int     `yaml:"max"`
+	Initial          int     `yaml:"initial"`
+	BackoffRatio     float64 `yaml:"backoffRatio"`
+	LatencyTolerance float64 `yaml:"latencyTolerance"`
+}
+
+func DefaultConcurrencyConfig() ConcurrencyConfig {
+	return ConcurrencyConfig{Adaptive: false, Min: 1, Max: 32, Initial: 4, BackoffRatio: 0.75, LatencyTolerance: 2}
+}
+
+func NewLimiter(maxConcurrency int, config ConcurrencyConfig) Limiter {
+	if config.Adaptive {
+		return NewAIMDLimiter(config)
+	}
+	return NewFixedLimiter(maxConcurrency)
+}
+
+// FixedLimiter hands out a fixed number of tokens from a channel.
+type FixedLimiter struct {
+	size              int
+	concurrentChannel chan interface{}
+}
+
+func NewFixedLimiter(size int) *FixedLimiter {
+	size = max(size, 1)
+	return &FixedLimiter{size: size, concurrentChannel: setupConcurrentChannel(size)}
+}
+
+func (l *FixedLimiter) Acquire(ctx context.Context) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-l.concurrentChannel:
+		return true
+	}
+}
+
+func (l *FixedLimiter) Release(time.Duration, bool) {
+	l.concurrentChannel <- struct{}{}
+}
+
+func (l *FixedLimiter) Limit() int {
+	return l.size
+}
+
+func (l *FixedLimiter) Adjustments() (int64, int64) {
+	return 0, 0
+}
+
+func setupConcurrentChannel(size int) chan interface{} {
+	c := make(chan interface{}, size)
+	populateChan(c, size)
+	return c
+}
+
+func populateChan(c chan<- interface{}, size int) {
+	for i := range size {
+		c <- i
+	}
+}
+
+// AIMDLimiter is an additive increase, multiplicative decrease limiter.
+type AIMDLimiter struct {
+	config ConcurrencyConfig
+
+	mutex    sync.Mutex
+	limit    float64
+	inFlight int
+	wake     chan struct{}
+	smoothed time.Duration
+	baseline time.Duration
+	// holdOff counts down the releases of the words in flight at the last decrease, which can't lower the limit again.
+	holdOff   int
+	increases int64
+	decreases int64
+}
+
+func NewAIMDLimiter(config ConcurrencyConfig) *AIMDLimiter {
+	config.Min = max(config.Min, 1)
+	config.Max = max(config.Max, config.Min)
+	initial := min(max(config.Initial, config.Min), config.Max)
+
+	return &AIMDLimiter{config: config, limit: float64(initial), wake: make(chan struct{})}
+}
+
+func (l *AIMDLimiter) Acquire(ctx context.Context) bool {
+	for {
+		l.mutex.Lock()
+		if l.inFlight < int(l.limit) {
+			l.inFlight++
+			l.mutex.Unlock()
+			return true
+		}
+		wake := l.wake
+		l.mutex.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-wake:
+		}
+	}
+}
+
+func (l *AIMDLimiter) Release(latency time.Duration, failed bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.inFlight--
+	holding := l.holdOff > 0
+	l.holdOff = max(l.holdOff-1, 0)
+	if latency <= 0 && !failed {
+		close(l.wake)
+		l.wake = make(chan struct{})
+		return
+	}
+	before := int(l.limit)
+
+	if l.smoothed == 0 {
+		l.smoothed = latency
+	} else {
+		l.smoothed = (l.smoothed*9 + latency) / 10
+	}
+	if l.baseline == 0 || l.smoothed < l.baseline {
+		l.baseline = l.smoothed
+	} else {
+		l.baseline += (l.smoothed - l.baseline) / 1000
+	}
+
+	slow := l.config.LatencyTolerance > 0 && float64(latency) > float64(l.baseline)*l.config.LatencyTolerance
+	if failed || slow {
+		if !holding {
+			l.limit = math.Max(float64(l.config.Min), l.limit*l.config.BackoffRatio)
+			l.holdOff = l.inFlight
+		}
+	} else {
+		l.limit = math.Min(float64(l.config.Max), l.limit+1/l.limit)
+	}
+
+	after := int(l.limit)
+	if after > before {
+		l.increases++
+		getLogger().Debugf("concurrency limit raised to (%d), latency (%s), baseline (%s)", after, latency, l.baseline)
+	} else if after < before {
+		l.decreases++
+		getLogger().Infof("concurrency limit lowered to (%d), failed (%t), latency (%s), baseline (%s)", after, failed, latency, l.baseline)
+	}
+
+	close(l.wake)
+	l.wake = make(chan struct{})
+}
+
+func (l *AIMDLimiter) Limit() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return int(l.limit)
+}
+
+func (l *AIMDLimiter) Adjustments() (int64, int64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.increases, l.decreases
+}
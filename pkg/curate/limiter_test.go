@@ -0,0 +1,110 @@
+package curate
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func testLimiterConfig() ConcurrencyConfig {
+	config := DefaultConcurrencyConfig()
+	config.Adaptive = true
+	config.Min, config.Max, config.Initial = 2, 8, 4
+	return config
+}
+
+// acquireAll takes every word the limit allows and checks that the next one has to wait.
+func acquireAll(t *testing.T, limiter Limiter) int {
+	t.Helper()
+	limit := limiter.Limit()
+	for range limit {
+		if !limiter.Acquire(context.Background()) {
+			t.Fatal("limiter refused a word below its limit")
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if limiter.Acquire(ctx) {
+		t.Fatal("limiter allowed a word over its limit")
+	}
+	return limit
+}
+
+func TestAIMDLimiterGrow(t *testing.T) {
+	limiter := NewAIMDLimiter(testLimiterConfig())
+	if limiter.Limit() != 4 {
+		t.Fatalf("initial limit (%d), expected 4", limiter.Limit())
+	}
+
+	// healthy words raise the limit by one per limit's worth, up to the max
+	for range 100 {
+		acquired := acquireAll(t, limiter)
+		for range acquired {
+			limiter.Release(10*time.Millisecond, false)
+		}
+	}
+	if limiter.Limit() != 8 {
+		t.Errorf("limit after healthy words (%d), expected the max 8", limiter.Limit())
+	}
+	if increases, decreases := limiter.Adjustments(); increases != 4 || decreases != 0 {
+		t.Errorf("adjustments (%d, %d), expected (4, 0)", increases, decreases)
+	}
+}
+
+func TestAIMDLimiterShrink(t *testing.T) {
+	config := testLimiterConfig()
+	config.Initial = 8
+	limiter := NewAIMDLimiter(config)
+
+	// a burst of failures from the words in flight lowers the limit once
+	acquired := acquireAll(t, limiter)
+	for range acquired {
+		limiter.Release(10*time.Millisecond, true)
+	}
+	if limiter.Limit() != 6 {
+		t.Errorf("limit after a burst of failures (%d), expected 6", limiter.Limit())
+	}
+
+	// each later window of failures lowers it again, down to the min
+	for range 10 {
+		acquired := acquireAll(t, limiter)
+		for range acquired {
+			limiter.Release(10*time.Millisecond, true)
+		}
+	}
+	if limiter.Limit() != 2 {
+		t.Errorf("limit after repeated failures (%d), expected the min 2", limiter.Limit())
+	}
+
+	// a slow word counts as a failure
+	limiter = NewAIMDLimiter(config)
+	limiter.Acquire(context.Background())
+	limiter.Release(10*time.Millisecond, false)
+	limiter.Acquire(context.Background())
+	limiter.Release(time.Second, false)
+	if limiter.Limit() != 6 {
+		t.Errorf("limit after a slow word (%d), expected 6", limiter.Limit())
+	}
+}
+
+func TestAIMDLimiterBounds(t *testing.T) {
+	config := testLimiterConfig()
+	config.Initial = 20
+	if limit := NewAIMDLimiter(config).Limit(); limit != 8 {
+		t.Errorf("initial above the max gave limit (%d), expected 8", limit)
+	}
+
+	config.Initial, config.Min, config.Max = 0, 0, 0
+	limiter := NewAIMDLimiter(config)
+	if limiter.Limit() != 1 {
+		t.Errorf("zero bounds gave limit (%d), expected 1", limiter.Limit())
+	}
+	for range 5 {
+		limiter.Acquire(context.Background())
+		limiter.Release(10*time.Millisecond, true)
+	}
+	if limiter.Limit() != 1 {
+		t.Errorf("failures lowered the limit to (%d), below 1", limiter.Limit())
+	}
+}
@@ -0,0 +1,236 @@
+package curate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"ozzysoft.net/wordle/pkg/llama"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+const (
+	runIDLayout     = "20060102-150405"
+	runManifestFile = "manifest.json"
+	runResultsFile  = "results.jsonl"
+)
+
+// RunCounts are the words a run read, skipped and decided.
+type RunCounts struct {
+	Words        int64 `json:"words"`
+	Skipped      int64 `json:"skipped"`
+	Processed    int64 `json:"processed"`
+	Curated      int64 `json:"curated"`
+	Excluded     int64 `json:"excluded"`
+	GuessOnly    int64 `json:"guess_only"`
+	Undetermined int64 `json:"undetermined"`
+	Overridden   int64 `json:"overridden"`
+	DeadLetters  int64 `json:"dead_letters"`
+}
+
+// RunManifest records what produced a curation run, written to the run's directory when it ends.
+type RunManifest struct {
+	RunID         string                 `json:"run_id"`
+	StartedAt     time.Time              `json:"started_at"`
+	FinishedAt    time.Time              `json:"finished_at"`
+	ElapsedMs     float64                `json:"elapsed_ms"`
+	AverageMs     float64                `json:"average_ms"`
+	Resumed       bool                   `json:"resumed"`
+	Interrupted   bool                   `json:"interrupted"`
+	GitRevision   string                 `json:"git_revision"`
+	GitModified   bool                   `json:"git_modified,omitempty"`
+	Backend       string                 `json:"backend"`
+	Model         string                 `json:"model"`
+	Models        []string               `json:"models"`
+	ModelDigest   string                 `json:"model_digest,omitempty"`
+	Prompt        string                 `json:"prompt"`
+	PromptVersion string                 `json:"prompt_version"`
+	Template      string                 `json:"template"`
+	Format        ResponseFormat         `json:"format"`
+	Options       map[string]interface{} `json:"options"`
+	Cascade       bool                   `json:"cascade,omitempty"`
+	Voters        int                    `json:"voters,omitempty"`
+	BatchSize     int                    `json:"batch_size"`
+	InputPath     string                 `json:"input_path"`
+	InputHash     string                 `json:"input_hash"`
+	ResultsPath   string                 `json:"results_path"`
+	Counts        RunCounts              `json:"counts"`
+}
+
+// newRunManifest records the settings of a run about to start.  The counts and durations are filled in when it ends.
+func newRunManifest(ctx context.Context, backend llama.Backend, config Config, resume bool) RunManifest {
+	prompt := config.Determine.prompt()
+	manifest := RunManifest{
+		StartedAt:     time.Now(),
+		Resumed:       resume,
+		Backend:       backend.Name(),
+		Model:         tierModels(firstTier(config), "")[0],
+		Models:        runModels(config),
+		Prompt:        prompt.Name,
+		PromptVersion: prompt.Version,
+		Template:      prompt.Template,
+		Format:        config.Determine.Format,
+		Options:       config.Determine.promptOptions(),
+		Cascade:       config.Cascade.Enabled,
+		Voters:        len(config.Ensemble.Voters),
+		BatchSize:     max(config.Batch.Size, 1),
+		InputPath:     config.InputPath,
+		ResultsPath:   runResultsFile,
+	}
+	manifest.GitRevision, manifest.GitModified = gitRevision()
+
+	if describer, ok := backend.(llama.ModelDescriber); ok {
+		digest, err := describer.ModelDigest(ctx, manifest.Model)
+		if err != nil {
+			getLogger().Infof("no digest for model (%s) in the run manifest.  (%s)", manifest.Model, err)
+		}
+		manifest.ModelDigest = digest
+	}
+
+	hash, err := hashFile(config.InputPath)
+	if err != nil {
+		getLogger().Warnf("failed to hash input for the run manifest.  (%s)", err)
+	}
+	manifest.InputHash = hash
+
+	return manifest
+}
+
+// runModels lists the models answering the words, the determine model or the ensemble voters of each cascade tier.
+func runModels(config Config) []string {
+	if !config.Cascade.Enabled {
+		return tierModels(firstTier(config), "")
+	}
+	return append(tierModels(config.Cascade.Fast, " (fast)"), tierModels(config.Cascade.Strong, " (strong)")...)
+}
+
+// firstTier is the cascade's fast tier, or the determine and ensemble settings without a cascade.
+func firstTier(config Config) TierConfig {
+	if config.Cascade.Enabled {
+		return config.Cascade.Fast
+	}
+	return TierConfig{Determine: config.Determine, Ensemble: config.Ensemble}
+}
+
+func tierModels(tier TierConfig, suffix string) []string {
+	if len(tier.Ensemble.Voters) == 0 {
+		return []string{tier.Determine.model() + suffix}
+	}
+
+	models := make([]string, 0, len(tier.Ensemble.Voters))
+	for _, voter := range tier.Ensemble.Voters {
+		models = append(models, voter.Model+suffix)
+	}
+	return models
+}
+
+// finish fills in the counts and durations of the ended run.
+func (m *RunManifest) finish(stats *RunStats, words int, skipped int, interrupted bool) {
+	m.FinishedAt = time.Now()
+	m.ElapsedMs = milliseconds(m.FinishedAt.Sub(m.StartedAt))
+	m.Interrupted = interrupted
+	m.Counts = stats.counts()
+	m.Counts.Words = int64(words)
+	m.Counts.Skipped = int64(skipped)
+	if m.Counts.Processed > 0 {
+		m.AverageMs = m.ElapsedMs / float64(m.Counts.Processed)
+	}
+}
+
+// WriteRun creates a directory for the run under runsDir, named by its start time, and writes the manifest and a copy
+// of the results file there.  It returns the run directory.
+func WriteRun(runsDir string, manifest RunManifest, resultsPath string) (string, error) {
+	if err := os.MkdirAll(runsDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create runs dir (%s). %w", runsDir, err)
+	}
+
+	// runs started in the same second get a suffix
+	id := manifest.StartedAt.Format(runIDLayout)
+	dir := filepath.Join(runsDir, id)
+	for i := 2; ; i++ {
+		err := os.Mkdir(dir, 0755)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return "", fmt.Errorf("failed to create run dir (%s). %w", dir, err)
+		}
+		id = fmt.Sprintf("%s-%d", manifest.StartedAt.Format(runIDLayout), i)
+		dir = filepath.Join(runsDir, id)
+	}
+	manifest.RunID = id
+
+	results, err := os.ReadFile(resultsPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("failed to read results (%s). %w", resultsPath, err)
+	}
+	if err := writeFileAtomic(filepath.Join(dir, runResultsFile), results); err != nil {
+		return "", err
+	}
+	if err := writeJSONFile(filepath.Join(dir, runManifestFile), manifest); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// LoadRunManifest reads a manifest written by WriteRun.
+func LoadRunManifest(path string) (RunManifest, error) {
+	var manifest RunManifest
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return manifest, fmt.Errorf("failed to read run manifest (%s). %w", path, err)
+	}
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		return manifest, fmt.Errorf("failed to unmarshal run manifest (%s). %w", path, err)
+	}
+	return manifest, nil
+}
+
+// gitRevision returns the revision the binary was built from, asking git when the build didn't record it.
+func gitRevision() (string, bool) {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		revision, modified := "", false
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				revision = setting.Value
+			case "vcs.modified":
+				modified = setting.Value == "true"
+			}
+		}
+		if revision != "" {
+			return revision, modified
+		}
+	}
+
+	out, err := exec.Command("git", "rev-parse", "HEAD").Output()
+	if err != nil {
+		getLogger().Debugf("failed to get the git revision.  (%s)", err)
+		return "", false
+	}
+	status, err := exec.Command("git", "status", "--porcelain", "--untracked-files=no").Output()
+	return strings.TrimSpace(string(out)), err == nil && len(status) > 0
+}
+
+// hashFile returns the hex sha256 of the file.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open (%s). %w", path, err)
+	}
+	defer doClose(f)
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to read (%s). %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
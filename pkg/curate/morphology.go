@@ -0,0 +1,181 @@
+package curate
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const morphologyStage = "morphology"
+
+// MorphologyConfig finds inflected forms of shorter words in the Lexicon files, or in the word lists without any.
+type MorphologyConfig struct {
+	Mode    StageMode `yaml:"mode"`
+	Lexicon []string  `yaml:"lexicon"`
+	// MinBase is the shortest base word a rule may strip down to.
+	MinBase int `yaml:"minBase"`
+}
+
+func DefaultMorphologyConfig() MorphologyConfig {
+	return MorphologyConfig{Mode: StageFlag, Lexicon: []string{"data/lexicon.txt"}, MinBase: 3}
+}
+
+// MorphologyStage tags (or excludes) inflected forms of words in its lexicon.
+type MorphologyStage struct {
+	mode    StageMode
+	minBase int
+	lexicon map[string]bool
+}
+
+// NewMorphologyStage loads the Lexicon files, or the existing wordLists when there are none.
+func NewMorphologyStage(config MorphologyConfig, wordLists []string) (*MorphologyStage, error) {
+	lexicon := make(map[string]bool)
+	for _, path := range config.Lexicon {
+		if err := loadLexicon(path, lexicon); err != nil {
+			return nil, err
+		}
+	}
+	if len(config.Lexicon) == 0 {
+		for _, path := range wordLists {
+			if err := loadLexicon(path, lexicon); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return nil, err
+			}
+		}
+	}
+
+	// the word lists have a single word length, so they only hold base words when they mix in shorter ones
+	lengths := make(map[int]bool)
+	for word := range lexicon {
+		lengths[len(word)] = true
+	}
+	if len(lexicon) == 0 || (len(config.Lexicon) == 0 && len(lengths) < 2) {
+		getLogger().Warnf("morphology stage has no shorter base words, it won't tag anything.  Add a general word list to its lexicon")
+	}
+
+	getLogger().Infof("morphology stage, mode (%s), lexicon files (%d), lexicon words (%d)", config.Mode, len(config.Lexicon), len(lexicon))
+	return &MorphologyStage{mode: config.Mode, minBase: max(config.MinBase, 1), lexicon: lexicon}, nil
+}
+
+// loadLexicon adds the all lowercase words of the file, one per line.
+func loadLexicon(path string, lexicon map[string]bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open lexicon (%s). %w", path, err)
+	}
+	defer doClose(f)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		word := strings.TrimSpace(scanner.Text())
+		if isLowerWord(word) {
+			lexicon[word] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read lexicon (%s). %w", path, err)
+	}
+	return nil
+}
+
+func isLowerWord(word string) bool {
+	if word == "" {
+		return false
+	}
+	for _, r := range word {
+		if r < 'a' || r > 'z' {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *MorphologyStage) Name() string {
+	return morphologyStage
+}
+
+func (s *MorphologyStage) Inspect(ctx context.Context, word string) ([]Tag, *Determination) {
+	rule, base, found := s.inflection(word)
+	if !found {
+		return nil, nil
+	}
+
+	tags := []Tag{{Stage: morphologyStage, Rule: rule, Detail: base}}
+	if s.mode != StageExclude {
+		return tags, nil
+	}
+
+	return tags, &Determination{
+		Decision: DecisionExclude,
+		Reason:   ReasonNone,
+		Response: fmt.Sprintf("%s form of (%s)", rule, base),
+	}
+}
+
+// inflectionCandidate is a rule and the base word it strips the word down to.
+type inflectionCandidate struct {
+	rule string
+	base string
+}
+
+// inflection returns the first rule whose base word is in the lexicon.
+func (s *MorphologyStage) inflection(word string) (string, string, bool) {
+	for _, candidate := range inflectionCandidates(word) {
+		if len(candidate.base) >= s.minBase && candidate.base != word && s.lexicon[candidate.base] {
+			return candidate.rule, candidate.base, true
+		}
+	}
+	return "", "", false
+}
+
+// inflectionCandidates lists the possible base words of word, most specific rule first.
+func inflectionCandidates(word string) []inflectionCandidate {
+	var candidates []inflectionCandidate
+	add := func(rule string, base string) {
+		candidates = append(candidates, inflectionCandidate{rule: rule, base: base})
+	}
+
+	// -ies/-ied/-ier/-iest from a final y: flies, tried, happier, happiest
+	for _, ending := range []struct{ suffix, family string }{{"ies", "s_form"}, {"ied", "past"}, {"ier", "comparative"}, {"iest", "superlative"}} {
+		if stem, found := strings.CutSuffix(word, ending.suffix); found {
+			add(ending.family+":"+ending.suffix, stem+"y")
+		}
+	}
+
+	// -s and -es forms: cards, boxes, wishes.  -ss, -us and -is endings are rarely inflections
+	if stem, found := strings.CutSuffix(word, "es"); found && hasSibilantEnding(stem) {
+		add("s_form:es", stem)
+	}
+	if stem, found := strings.CutSuffix(word, "s"); found && !strings.HasSuffix(word, "ss") && !strings.HasSuffix(word, "us") && !strings.HasSuffix(word, "is") {
+		add("s_form:s", stem)
+	}
+
+	// -ed, -er and -est after a final e (fined, not fin) or doubled consonant, only -ed strips to the bare stem
+	for _, ending := range []struct{ suffix, family string }{{"ed", "past"}, {"er", "comparative"}, {"est", "superlative"}} {
+		stem, found := strings.CutSuffix(word, ending.suffix)
+		if !found {
+			continue
+		}
+		add(ending.family+":"+ending.suffix+"_e", stem+"e")
+		if ending.suffix == "ed" {
+			add(ending.family+":"+ending.suffix, stem)
+		}
+		if n := len(stem); n >= 2 && stem[n-1] == stem[n-2] && !strings.ContainsRune("aeiou", rune(stem[n-1])) {
+			add(ending.family+":doubled", stem[:n-1])
+		}
+	}
+
+	return candidates
+}
+
+// hasSibilantEnding is true for stems taking -es rather than -s: boxes, buzzes, wishes, churches, glasses, echoes.
+func hasSibilantEnding(stem string) bool {
+	for _, ending := range []string{"s", "x", "z", "ch", "sh", "o"} {
+		if strings.HasSuffix(stem, ending) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package curate
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMorphologyInflection(t *testing.T) {
+	stage := &MorphologyStage{mode: StageFlag, minBase: 3, lexicon: make(map[string]bool)}
+	for _, word := range []string{"aft", "time", "tow", "off", "cove", "pow", "wat", "for", "mod", "card", "box", "fly",
+		"try", "bake", "fin", "fine", "nice", "ripe", "stop", "big", "hot", "jump", "happy", "tall"} {
+		stage.lexicon[word] = true
+	}
+
+	for word, expected := range map[string]string{
+		"cards":   "card",
+		"boxes":   "box",
+		"flies":   "fly",
+		"tried":   "try",
+		"happier": "happy",
+		"baked":   "bake",
+		"fined":   "fine",
+		"jumped":  "jump",
+		"nicer":   "nice",
+		"ripest":  "ripe",
+		"stopped": "stop",
+		"bigger":  "big",
+		"hottest": "hot",
+		// a base ending in e still counts, the rules can't tell a noun from a comparative
+		"timer": "time",
+		"cover": "cove",
+		// a bare -er or -est doesn't
+		"after":   "",
+		"tower":   "",
+		"offer":   "",
+		"power":   "",
+		"water":   "",
+		"forest":  "",
+		"modest":  "",
+		"taller":  "",
+		"glass":   "",
+		"campus":  "",
+		"jumpers": "",
+	} {
+		_, base, found := stage.inflection(word)
+		if found != (expected != "") || base != expected {
+			t.Errorf("word (%s) has base (%s), expected (%s)", word, base, expected)
+		}
+	}
+}
+
+func TestMorphologyLexicon(t *testing.T) {
+	lexiconPath := filepath.Join(t.TempDir(), "lexicon.txt")
+	if err := os.WriteFile(lexiconPath, []byte("box\nParis\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stage, err := NewMorphologyStage(MorphologyConfig{Mode: StageExclude, Lexicon: []string{lexiconPath}, MinBase: 3}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, determination := stage.Inspect(context.Background(), "boxes"); determination == nil || determination.Decision != DecisionExclude {
+		t.Errorf("boxes determination (%v), expected excluded", determination)
+	}
+	if tags, _ := stage.Inspect(context.Background(), "parises"); len(tags) != 0 {
+		t.Errorf("parises tagged (%v), capitalized lexicon entries aren't base words", tags)
+	}
+}
+
+func TestMorphologyWordLists(t *testing.T) {
+	dir := t.TempDir()
+	fivePath, mixedPath := filepath.Join(dir, "five.txt"), filepath.Join(dir, "mixed.txt")
+	if err := os.WriteFile(fivePath, []byte("boxes\ncards\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(mixedPath, []byte("card\ncards\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// without lexicon files the word lists are the lexicon, a missing list is skipped
+	for path, expected := range map[string]int{fivePath: 0, mixedPath: 1} {
+		stage, err := NewMorphologyStage(MorphologyConfig{Mode: StageFlag, MinBase: 3}, []string{path, filepath.Join(dir, "missing.txt")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tags, _ := stage.Inspect(context.Background(), "cards"); len(tags) != expected {
+			t.Errorf("word list (%s) tagged cards (%v), expected tags (%d)", filepath.Base(path), tags, expected)
+		}
+	}
+
+	// the shipped lexicon has the base words
+	config := DefaultMorphologyConfig()
+	config.Lexicon = []string{"../../data/lexicon.txt"}
+	stage, err := NewMorphologyStage(config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, word := range []string{"cards", "boxes", "baked"} {
+		if tags, _ := stage.Inspect(context.Background(), word); len(tags) != 1 {
+			t.Errorf("word (%s) tagged (%v) with the shipped lexicon", word, tags)
+		}
+	}
+}
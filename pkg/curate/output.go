@@ -0,0 +1,485 @@
+package curate
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"ozzysoft.net/wordle/pkg/llama"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ResultWriter persists curate results as they arrive from the workers.
+type ResultWriter interface {
+	Write(result CurateResult) error
+	Close()
+}
+
+// sortedWriter is a ResultWriter that holds its entries until it is closed, then writes them in word order.
+type sortedWriter interface {
+	ResultWriter
+	add(record ResultRecord)
+}
+
+// ResultMetrics mirrors the backend generate metrics, with durations in milliseconds.
+type ResultMetrics struct {
+	TotalDurationMs      float64 `json:"total_duration_ms"`
+	LoadDurationMs       float64 `json:"load_duration_ms"`
+	PromptEvalCount      int     `json:"prompt_eval_count"`
+	PromptEvalDurationMs float64 `json:"prompt_eval_duration_ms"`
+	EvalCount            int     `json:"eval_count"`
+	EvalDurationMs       float64 `json:"eval_duration_ms"`
+}
+
+// ResultRecord is the structured form of a curate result, written one json object per line.
+type ResultRecord struct {
+	Word          string        `json:"word"`
+	Decision      Decision      `json:"decision"`
+	Reason        string        `json:"reason,omitempty"`
+	Response      string        `json:"response"`
+	Verdict       *Verdict      `json:"verdict,omitempty"`
+	Model         string        `json:"model"`
+	Prompt        string        `json:"prompt"`
+	PromptVersion string        `json:"prompt_version"`
+	LatencyMs     float64       `json:"latency_ms"`
+	Metrics       ResultMetrics `json:"metrics"`
+	Error         string        `json:"error,omitempty"`
+	Policy        string        `json:"policy,omitempty"`
+	Votes         []Vote        `json:"votes,omitempty"`
+	Tier          string        `json:"tier,omitempty"`
+	Escalation    *Escalation   `json:"escalation,omitempty"`
+	Attempts      int           `json:"attempts"`
+	DeadLetter    bool          `json:"dead_letter,omitempty"`
+	TokensSaved   int           `json:"tokens_saved,omitempty"`
+	BatchSize     int           `json:"batch_size,omitempty"`
+	Tags          []Tag         `json:"tags,omitempty"`
+	Override      *Override     `json:"override,omitempty"`
+	Timestamp     time.Time     `json:"timestamp"`
+}
+
+func NewResultRecord(result CurateResult) ResultRecord {
+	record := ResultRecord{
+		Word:          result.word,
+		Decision:      result.decision,
+		Reason:        string(result.reason),
+		Response:      result.response,
+		Verdict:       result.verdict,
+		Model:         result.model,
+		Prompt:        result.prompt,
+		PromptVersion: result.promptVersion,
+		LatencyMs:     milliseconds(result.latency),
+		Metrics: ResultMetrics{
+			TotalDurationMs:      milliseconds(result.metrics.TotalDuration),
+			LoadDurationMs:       milliseconds(result.metrics.LoadDuration),
+			PromptEvalCount:      result.metrics.PromptEvalCount,
+			PromptEvalDurationMs: milliseconds(result.metrics.PromptEvalDuration),
+			EvalCount:            result.metrics.EvalCount,
+			EvalDurationMs:       milliseconds(result.metrics.EvalDuration),
+		},
+		Policy:      result.policy,
+		Votes:       result.votes,
+		Tier:        result.tier,
+		Escalation:  result.escalation,
+		Attempts:    result.attempts,
+		DeadLetter:  result.deadLetter,
+		TokensSaved: result.tokensSaved,
+		BatchSize:   result.batchSize,
+		Tags:        result.tags,
+		Override:    result.override,
+		Timestamp:   result.timestamp,
+	}
+
+	if result.err != nil {
+		record.Error = result.err.Error()
+	}
+
+	return record
+}
+
+// resultFromRecord rebuilds the result of a stored record without its override, so an override can be applied to an
+// earlier model answer without asking the model again.
+func resultFromRecord(record ResultRecord) CurateResult {
+	result := CurateResult{
+		word:          record.Word,
+		decision:      record.Decision,
+		reason:        UndeterminedReason(record.Reason),
+		response:      record.Response,
+		verdict:       record.Verdict,
+		model:         record.Model,
+		prompt:        record.Prompt,
+		promptVersion: record.PromptVersion,
+		metrics: llama.Metrics{
+			TotalDuration:      duration(record.Metrics.TotalDurationMs),
+			LoadDuration:       duration(record.Metrics.LoadDurationMs),
+			PromptEvalCount:    record.Metrics.PromptEvalCount,
+			PromptEvalDuration: duration(record.Metrics.PromptEvalDurationMs),
+			EvalCount:          record.Metrics.EvalCount,
+			EvalDuration:       duration(record.Metrics.EvalDurationMs),
+		},
+		policy:      record.Policy,
+		votes:       record.Votes,
+		tier:        record.Tier,
+		escalation:  record.Escalation,
+		attempts:    record.Attempts,
+		tokensSaved: record.TokensSaved,
+		batchSize:   record.BatchSize,
+		latency:     duration(record.LatencyMs),
+		timestamp:   time.Now(),
+	}
+	for _, tag := range record.Tags {
+		if tag.Stage != overrideStage {
+			result.tags = append(result.tags, tag)
+		}
+	}
+	return result
+}
+
+// LoadResultRecords reads a results file, the last record for a word wins.  A missing file has no records.
+func LoadResultRecords(path string) (map[string]ResultRecord, error) {
+	records := make(map[string]ResultRecord)
+
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return records, nil
+		}
+		return nil, fmt.Errorf("failed to open results (%s). %w", path, err)
+	}
+	defer doClose(f)
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var record ResultRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			getLogger().Warnf("skipping invalid result line (%s). (%s)", line, err)
+			continue
+		}
+		records[record.Word] = record
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read results (%s). %w", path, err)
+	}
+	return records, nil
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func duration(milliseconds float64) time.Duration {
+	return time.Duration(milliseconds * float64(time.Millisecond))
+}
+
+// writeFileAtomic writes b to a temporary file next to path and renames it over path, so a crash leaves either the old
+// file or the new one, never a partial file.
+func writeFileAtomic(path string, b []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create dir for (%s). %w", path, err)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file for (%s). %w", path, err)
+	}
+	if _, err := f.Write(b); err != nil {
+		doClose(f)
+		_ = os.Remove(f.Name())
+		return fmt.Errorf("failed to write (%s). %w", f.Name(), err)
+	}
+	if err := f.Sync(); err != nil {
+		doClose(f)
+		_ = os.Remove(f.Name())
+		return fmt.Errorf("failed to sync (%s). %w", f.Name(), err)
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(f.Name())
+		return fmt.Errorf("failed to close (%s). %w", f.Name(), err)
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		_ = os.Remove(f.Name())
+		return fmt.Errorf("failed to chmod (%s). %w", f.Name(), err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		_ = os.Remove(f.Name())
+		return fmt.Errorf("failed to rename (%s) to (%s). %w", f.Name(), path, err)
+	}
+	return nil
+}
+
+// writeSortedFile writes the lines in word order, one entry per word, with unix line endings.
+func writeSortedFile(path string, lines map[string]string) error {
+	words := slices.Sorted(maps.Keys(lines))
+
+	var b strings.Builder
+	for _, word := range words {
+		b.WriteString(normalizeLineEndings(lines[word]))
+		b.WriteByte('\n')
+	}
+	return writeFileAtomic(path, []byte(b.String()))
+}
+
+// normalizeLineEndings turns windows and old mac line endings into unix ones, and drops trailing ones.
+func normalizeLineEndings(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.ReplaceAll(s, "\r", "\n")
+	return strings.TrimRight(s, "\n")
+}
+
+// readWordList reads a word per line, a missing file has no words.
+func readWordList(path string) (map[string]string, error) {
+	words := make(map[string]string)
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return words, nil
+		}
+		return nil, fmt.Errorf("failed to read word list (%s). %w", path, err)
+	}
+
+	for _, line := range strings.Split(normalizeLineEndings(string(b)), "\n") {
+		if word := strings.TrimSpace(line); word != "" {
+			words[word] = word
+		}
+	}
+	return words, nil
+}
+
+// JSONLWriter streams a ResultRecord per line as results arrive.
+type JSONLWriter struct {
+	file    *os.File
+	encoder *json.Encoder
+}
+
+func NewJSONLWriter(path string, resume bool) (*JSONLWriter, error) {
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if !resume {
+		flags |= os.O_TRUNC
+	}
+
+	f, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open output file (%s). %w", path, err)
+	}
+
+	return &JSONLWriter{file: f, encoder: json.NewEncoder(f)}, nil
+}
+
+func (w *JSONLWriter) Write(result CurateResult) error {
+	if err := w.encoder.Encode(NewResultRecord(result)); err != nil {
+		return fmt.Errorf("failed to write result for word (%s) to (%s). %w", result.word, w.file.Name(), err)
+	}
+	return nil
+}
+
+func (w *JSONLWriter) Close() {
+	doClose(w.file)
+	if err := w.compact(); err != nil {
+		getLogger().Errorf("failed to sort results, the streamed results are kept.  (%s)", err)
+	}
+}
+
+// compact rewrites the results file in word order, keeping the last record for each word.
+func (w *JSONLWriter) compact() error {
+	path := w.file.Name()
+	records, err := LoadResultRecords(path)
+	if err != nil {
+		return err
+	}
+
+	lines := make(map[string]string, len(records))
+	for word, record := range records {
+		b, err := json.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("failed to marshal result for word (%s). %w", word, err)
+		}
+		lines[word] = string(b)
+	}
+	return writeSortedFile(path, lines)
+}
+
+// The sorted writers below write their files in word order when closed.
+
+// DeadLetterWriter lists the words that exhausted their retries, one per line, so a later run can process only them.
+type DeadLetterWriter struct {
+	path  string
+	words map[string]string
+}
+
+func NewDeadLetterWriter(path string, resume bool) (*DeadLetterWriter, error) {
+	w := &DeadLetterWriter{path: path, words: make(map[string]string)}
+	if resume {
+		words, err := readWordList(path)
+		if err != nil {
+			return nil, err
+		}
+		w.words = words
+	}
+	return w, nil
+}
+
+func (w *DeadLetterWriter) Write(result CurateResult) error {
+	w.add(NewResultRecord(result))
+	return nil
+}
+
+func (w *DeadLetterWriter) add(record ResultRecord) {
+	if record.DeadLetter {
+		w.words[record.Word] = record.Word
+	} else {
+		delete(w.words, record.Word)
+	}
+}
+
+func (w *DeadLetterWriter) Close() {
+	if err := writeSortedFile(w.path, w.words); err != nil {
+		getLogger().Errorf("failed to write dead letters.  (%s)", err)
+	}
+}
+
+// SensitiveWriter lists the words tagged by the sensitive stage, whatever their decision, with "word: tags: response"
+// lines alongside so a person can confirm them.
+type SensitiveWriter struct {
+	path         string
+	responsePath string
+	responses    map[string]string
+}
+
+func NewSensitiveWriter(path string, responsePath string, resume bool) (*SensitiveWriter, error) {
+	w := &SensitiveWriter{path: path, responsePath: responsePath, responses: make(map[string]string)}
+	if resume {
+		responses, err := readResponseFiles([]responseFile{{responsePath, DecisionUndetermined}}, nil)
+		if err != nil {
+			return nil, err
+		}
+		for word, legacy := range responses {
+			w.responses[word] = legacy.response
+		}
+	}
+	return w, nil
+}
+
+func (w *SensitiveWriter) Write(result CurateResult) error {
+	w.add(NewResultRecord(result))
+	return nil
+}
+
+func (w *SensitiveWriter) add(record ResultRecord) {
+	if !isSensitive(record.Tags) {
+		delete(w.responses, record.Word)
+		return
+	}
+
+	tags := make([]string, len(record.Tags))
+	for i, tag := range record.Tags {
+		tags[i] = tag.String()
+	}
+	w.responses[record.Word] = fmt.Sprintf("%s: %s", strings.Join(tags, ", "), record.Response)
+}
+
+func (w *SensitiveWriter) Close() {
+	words := make(map[string]string, len(w.responses))
+	lines := make(map[string]string, len(w.responses))
+	for word, response := range w.responses {
+		words[word] = word
+		lines[word] = word + ": " + response
+	}
+
+	if err := writeSortedFile(w.path, words); err != nil {
+		getLogger().Errorf("failed to write sensitive words.  (%s)", err)
+	}
+	if err := writeSortedFile(w.responsePath, lines); err != nil {
+		getLogger().Errorf("failed to write sensitive responses.  (%s)", err)
+	}
+}
+
+// LegacyWriter writes the original four file layout.
+type LegacyWriter struct {
+	files     []legacyFile
+	responses map[string]legacyResponse
+}
+
+// legacyFile is the word list and response file of a decision.
+type legacyFile struct {
+	decision     Decision
+	path         string
+	responsePath string
+}
+
+func NewLegacyWriter(config Config, resume bool) (*LegacyWriter, error) {
+	w := &LegacyWriter{
+		files: []legacyFile{
+			{DecisionKeep, config.CuratedPath, config.CuratedResponsePath},
+			{DecisionExclude, config.ExcludedPath, config.ExcludedResponsePath},
+			{DecisionUndetermined, config.UndeterminedPath, config.UndeterminedResponsePath},
+			{DecisionGuessOnly, config.GuessOnlyPath, config.GuessOnlyResponsePath},
+		},
+		responses: make(map[string]legacyResponse),
+	}
+
+	if resume {
+		files := make([]responseFile, len(w.files))
+		for i, file := range w.files {
+			files[i] = responseFile{file.responsePath, file.decision}
+		}
+		responses, err := readResponseFiles(files, inputWords(config))
+		if err != nil {
+			return nil, err
+		}
+		w.responses = responses
+	}
+
+	return w, nil
+}
+
+func (w *LegacyWriter) Write(result CurateResult) error {
+	w.add(NewResultRecord(result))
+	return nil
+}
+
+func (w *LegacyWriter) add(record ResultRecord) {
+	response := record.Response
+	if record.Decision == DecisionUndetermined {
+		response = fmt.Sprintf("[%s] %s", record.Reason, record.Response)
+		if record.Error != "" {
+			response = fmt.Sprintf("[%s] %s", record.Reason, record.Error)
+		}
+	}
+	if record.Override != nil {
+		response = strings.TrimSpace(fmt.Sprintf("[%s] %s", record.Override, response))
+	}
+
+	w.responses[record.Word] = legacyResponse{decision: record.Decision, response: response}
+}
+
+func (w *LegacyWriter) Close() {
+	for _, file := range w.files {
+		words := make(map[string]string)
+		lines := make(map[string]string)
+		for word, legacy := range w.responses {
+			if legacy.decision == file.decision {
+				words[word] = word
+				lines[word] = word + ": " + legacy.response
+			}
+		}
+
+		if err := writeSortedFile(file.path, words); err != nil {
+			getLogger().Errorf("failed to write (%s) words.  (%s)", file.decision, err)
+		}
+		if err := writeSortedFile(file.responsePath, lines); err != nil {
+			getLogger().Errorf("failed to write (%s) responses.  (%s)", file.decision, err)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package curate
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const overrideStage = "override"
+
+// OverridesConfig names the override files, which take precedence over the model.
+type OverridesConfig struct {
+	// IncludePath words are kept, ExcludePath words are excluded and GuessOnlyPath words are accepted as guesses but
+	// never used as answers.
+	IncludePath   string `yaml:"includePath"`
+	ExcludePath   string `yaml:"excludePath"`
+	GuessOnlyPath string `yaml:"guessOnlyPath"`
+}
+
+func DefaultOverridesConfig() OverridesConfig {
+	return OverridesConfig{
+		IncludePath:   "data/overrides/include.txt",
+		ExcludePath:   "data/overrides/exclude.txt",
+		GuessOnlyPath: "data/overrides/guess-only.txt",
+	}
+}
+
+// overrideDecisions are the decisions an override can force, in the order the files are read.
+var overrideDecisions = []Decision{DecisionKeep, DecisionExclude, DecisionGuessOnly}
+
+// path returns the override file forcing decision.
+func (c OverridesConfig) path(decision Decision) string {
+	switch decision {
+	case DecisionKeep:
+		return c.IncludePath
+	case DecisionExclude:
+		return c.ExcludePath
+	case DecisionGuessOnly:
+		return c.GuessOnlyPath
+	}
+	return ""
+}
+
+// Override is a decision made by a person, with why and by whom.
+type Override struct {
+	Word     string   `json:"word"`
+	Decision Decision `json:"decision"`
+	Reason   string   `json:"reason,omitempty"`
+	Author   string   `json:"author,omitempty"`
+}
+
+func (o Override) String() string {
+	s := fmt.Sprintf("overridden (%s)", o.Decision)
+	if o.Reason != "" {
+		s += fmt.Sprintf(", reason (%s)", o.Reason)
+	}
+	if o.Author != "" {
+		s += fmt.Sprintf(", author (%s)", o.Author)
+	}
+	return s
+}
+
+// Overrides are the overrides of every override file, by word.
+type Overrides struct {
+	entries map[string]Override
+}
+
+// LoadOverrides reads the override files.  A word may only be in one of them.
+func LoadOverrides(config OverridesConfig) (*Overrides, error) {
+	overrides := &Overrides{entries: make(map[string]Override)}
+	for _, decision := range overrideDecisions {
+		path := config.path(decision)
+		if path == "" {
+			continue
+		}
+		if err := overrides.load(path, decision); err != nil {
+			return nil, err
+		}
+	}
+
+	getLogger().Infof("loaded overrides (%d)", len(overrides.entries))
+	return overrides, nil
+}
+
+func (o *Overrides) load(path string, decision Decision) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("failed to open override file (%s). %w", path, err)
+	}
+	defer doClose(f)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		override := parseOverride(line, decision)
+		if other, found := o.entries[override.Word]; found && other.Decision != decision {
+			return fmt.Errorf("word (%s) is overridden as both (%s) and (%s), see (%s)", override.Word, other.Decision, decision, path)
+		}
+		o.entries[override.Word] = override
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read override file (%s). %w", path, err)
+	}
+	return nil
+}
+
+// parseOverride reads a "word | reason | author" line, the reason and author are optional.
+func parseOverride(line string, decision Decision) Override {
+	fields := strings.SplitN(line, "|", 3)
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+
+	override := Override{Word: strings.ToLower(fields[0]), Decision: decision}
+	if len(fields) > 1 {
+		override.Reason = fields[1]
+	}
+	if len(fields) > 2 {
+		override.Author = fields[2]
+	}
+	return override
+}
+
+func (o *Overrides) Lookup(word string) (Override, bool) {
+	override, found := o.entries[word]
+	return override, found
+}
+
+// changes is true when a journaled word needs redoing for the overrides.
+func (o *Overrides) changes(entry JournalEntry, record ResultRecord) bool {
+	override, found := o.entries[entry.Word]
+	recorded := record.Override != nil
+	if !found {
+		return entry.Override || recorded
+	}
+	if recorded {
+		return *record.Override != override
+	}
+	return entry.Decision != override.Decision || !entry.Override
+}
+
+// apply sets the override's decision on the result, keeping the model's answer when there is one.
+func (o *Overrides) apply(result CurateResult) CurateResult {
+	override, found := o.entries[result.word]
+	if !found || result.override != nil {
+		return result
+	}
+
+	result.decision = override.Decision
+	result.reason = ReasonNone
+	result.deadLetter = false
+	result.override = &override
+	result.tags = append(result.tags, Tag{Stage: overrideStage, Rule: string(override.Decision), Detail: override.Author})
+	return result
+}
+
+// AppendOverride adds the override to the override file for its decision, creating the file when needed.
+func AppendOverride(config OverridesConfig, override Override) error {
+	path := config.path(override.Decision)
+	if path == "" {
+		return fmt.Errorf("no override file for decision (%s)", override.Decision)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create override dir for (%s). %w", path, err)
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open override file (%s). %w", path, err)
+	}
+	defer doClose(f)
+
+	line := override.Word
+	if override.Reason != "" || override.Author != "" {
+		line += " | " + override.Reason
+	}
+	if override.Author != "" {
+		line += " | " + override.Author
+	}
+	if _, err := f.WriteString(line + "\n"); err != nil {
+		return fmt.Errorf("failed to write to override file (%s). %w", path, err)
+	}
+	return nil
+}
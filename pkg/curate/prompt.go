@@ -0,0 +1,274 @@
+package curate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io/fs"
+	"maps"
+	"os"
+	"ozzysoft.net/wordle/config/prompts"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+const (
+	textPromptName = "obscure"
+	jsonPromptName = "obscure-json"
+)
+
+// PromptExample is a few-shot example, a word and the answer the model should give for it.
+type PromptExample struct {
+	Word   string `yaml:"word"`
+	Answer string `yaml:"answer"`
+}
+
+// PromptDefinition is a versioned prompt.
+type PromptDefinition struct {
+	Name     string                 `yaml:"name"`
+	Version  string                 `yaml:"version"`
+	Format   ResponseFormat         `yaml:"format"`
+	Model    string                 `yaml:"model"`
+	System   string                 `yaml:"system"`
+	Template string                 `yaml:"template"`
+	Batch    string                 `yaml:"batchTemplate"`
+	Examples []PromptExample        `yaml:"examples"`
+	Options  map[string]interface{} `yaml:"options"`
+	Schema   map[string]interface{} `yaml:"schema"`
+
+	template *template.Template
+	batch    *template.Template
+	schema   json.RawMessage
+}
+
+// builtinPrompts are the prompt definitions of config/prompts built into the binary, available when the prompt
+// directory doesn't define them.
+func builtinPrompts() []*PromptDefinition {
+	files, err := fs.Glob(prompts.Builtin, "*.yaml")
+	if err != nil {
+		panic(err)
+	}
+
+	var builtin []*PromptDefinition
+	for _, file := range files {
+		b, err := prompts.Builtin.ReadFile(file)
+		if err != nil {
+			panic(err)
+		}
+		prompt, err := parsePrompt(b, file)
+		if err != nil {
+			panic(err)
+		}
+		builtin = append(builtin, prompt)
+	}
+	return builtin
+}
+
+// parsePrompt unmarshals and prepares the yaml prompt definition read from file.
+func parsePrompt(b []byte, file string) (*PromptDefinition, error) {
+	prompt := &PromptDefinition{}
+	if err := yaml.Unmarshal(b, prompt); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal prompt (%s). %w", file, err)
+	}
+	if err := prompt.prepare(); err != nil {
+		return nil, fmt.Errorf("invalid prompt (%s). %w", file, err)
+	}
+	return prompt, nil
+}
+
+// fallbackPrompts serve options that were never resolved against a prompt directory.
+var fallbackPrompts = sync.OnceValue(builtinPrompts)
+
+// prepare parses the template and schema, and checks the definition is usable.
+func (p *PromptDefinition) prepare() error {
+	if p.Name == "" || p.Version == "" {
+		return errors.New("prompt needs a name and a version")
+	}
+	if p.Format == "" {
+		p.Format = FormatJSON
+	}
+	if p.Format != FormatJSON && p.Format != FormatText {
+		return fmt.Errorf("prompt (%s) has an unknown format (%s)", p.Name, p.Format)
+	}
+
+	t, err := template.New(p.Name).Option("missingkey=error").Parse(p.Template)
+	if err != nil {
+		return fmt.Errorf("failed to parse prompt (%s) template. %w", p.Name, err)
+	}
+	p.template = t
+
+	p.batch = nil
+	if p.Batch != "" {
+		if p.batch, err = template.New(p.Name + "-batch").Option("missingkey=error").Parse(p.Batch); err != nil {
+			return fmt.Errorf("failed to parse prompt (%s) batch template. %w", p.Name, err)
+		}
+	}
+
+	p.schema = nil
+	if p.Format == FormatJSON {
+		p.schema = verdictSchema
+		if len(p.Schema) > 0 {
+			if p.schema, err = json.Marshal(p.Schema); err != nil {
+				return fmt.Errorf("failed to marshal prompt (%s) schema. %w", p.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// render returns the prompt for word.
+func (p *PromptDefinition) render(word string) (string, error) {
+	return p.renderResponse(word, "")
+}
+
+// renderResponse renders a question about an earlier response to word, such as the consistency judge's.
+func (p *PromptDefinition) renderResponse(word string, response string) (string, error) {
+	data := struct {
+		Word     string
+		Examples []PromptExample
+		Reasons  string
+		Response string
+	}{Word: word, Examples: p.Examples, Reasons: quotedReasonCodes(), Response: response}
+
+	var b strings.Builder
+	if err := p.template.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("failed to render prompt (%s) for word (%s). %w", p.Name, word, err)
+	}
+	return b.String(), nil
+}
+
+// renderBatch returns the batch prompt for words.
+func (p *PromptDefinition) renderBatch(words []string) (string, error) {
+	if p.batch == nil {
+		return "", fmt.Errorf("prompt (%s) has no batch template", p.Name)
+	}
+
+	data := struct {
+		Words    string
+		Examples []PromptExample
+		Reasons  string
+	}{Words: strings.Join(words, ", "), Examples: p.Examples, Reasons: quotedReasonCodes()}
+
+	var b strings.Builder
+	if err := p.batch.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("failed to render prompt (%s) for batch of words (%d). %w", p.Name, len(words), err)
+	}
+	return b.String(), nil
+}
+
+// LoadPrompts reads every yaml prompt definition in dir, on top of the builtin prompts.
+func LoadPrompts(dir string) (map[string]*PromptDefinition, error) {
+	prompts := make(map[string]*PromptDefinition)
+	for _, prompt := range builtinPrompts() {
+		prompts[prompt.Name] = prompt
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list prompt dir (%s). %w", dir, err)
+	}
+
+	loaded := make(map[string]string)
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read prompt (%s). %w", file, err)
+		}
+
+		prompt, err := parsePrompt(b, file)
+		if err != nil {
+			return nil, err
+		}
+		if other, found := loaded[prompt.Name]; found {
+			return nil, fmt.Errorf("prompt (%s) is defined in both (%s) and (%s)", prompt.Name, other, file)
+		}
+
+		loaded[prompt.Name] = file
+		prompts[prompt.Name] = prompt
+	}
+
+	getLogger().Infof("loaded prompts (%d) from (%s)", len(loaded), dir)
+	return prompts, nil
+}
+
+// resolvePrompt picks the named prompt, or the default prompt for the format when no name is given.
+func (o *DetermineOptions) resolvePrompt(prompts map[string]*PromptDefinition) error {
+	name := o.Prompt
+	if name == "" {
+		name = defaultPromptName(o.Format)
+	}
+
+	prompt, found := prompts[name]
+	if !found {
+		return fmt.Errorf("unknown prompt (%s)", name)
+	}
+
+	o.definition = prompt
+	o.Format = prompt.Format
+	return nil
+}
+
+func defaultPromptName(format ResponseFormat) string {
+	if format == FormatText {
+		return textPromptName
+	}
+	return jsonPromptName
+}
+
+// prompt returns the resolved prompt, falling back to the builtin prompt for the format.
+func (o DetermineOptions) prompt() *PromptDefinition {
+	if o.definition != nil {
+		return o.definition
+	}
+
+	name := defaultPromptName(o.Format)
+	for _, prompt := range fallbackPrompts() {
+		if prompt.Name == name {
+			return prompt
+		}
+	}
+	return nil
+}
+
+// model returns the configured model, then the prompt's model, then the default model.
+func (o DetermineOptions) model() string {
+	if o.Model != "" {
+		return o.Model
+	}
+	if prompt := o.prompt(); prompt != nil && prompt.Model != "" {
+		return prompt.Model
+	}
+	return defaultModel
+}
+
+// promptOptions merges the prompt's options with the configured ones, which take precedence.
+func (o DetermineOptions) promptOptions() map[string]interface{} {
+	options := make(map[string]interface{})
+	if prompt := o.prompt(); prompt != nil {
+		maps.Copy(options, prompt.Options)
+	}
+	maps.Copy(options, o.requestOptions())
+	return options
+}
+
+// resolvePrompts loads the prompt directory and resolves the prompt of every determine setting in the config, including
+// the sensitive and proper noun stages'.
+func (c *Config) resolvePrompts() error {
+	prompts, err := LoadPrompts(c.PromptDir)
+	if err != nil {
+		return err
+	}
+
+	for _, options := range []*DetermineOptions{&c.Determine, &c.Cascade.Fast.Determine, &c.Cascade.Strong.Determine, &c.Stages.Sensitive.Determine, &c.Stages.ProperNoun.Determine, &c.Consistency.Determine} {
+		if err := options.resolvePrompt(prompts); err != nil {
+			return err
+		}
+	}
+
+	getLogger().Infof("curating with prompt (%s), version (%s), model (%s)", c.Determine.prompt().Name, c.Determine.prompt().Version, c.Determine.model())
+	return nil
+}
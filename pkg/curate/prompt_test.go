@@ -0,0 +1,111 @@
+package curate
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"ozzysoft.net/wordle/pkg/llama"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestBuiltinPrompts(t *testing.T) {
+	prompts, err := LoadPrompts(filepath.Join(t.TempDir(), "missing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, required := range map[string]string{
+		textPromptName:        "",
+		jsonPromptName:        "definition",
+		properNounPromptName:  "common_sense",
+		sensitivePromptName:   "category",
+		consistencyPromptName: "consistent",
+	} {
+		prompt, found := prompts[name]
+		if !found {
+			t.Errorf("builtin prompt (%s) is missing", name)
+			continue
+		}
+		if prompt.Version == "" {
+			t.Errorf("builtin prompt (%s) has no version", name)
+		}
+
+		var schema struct {
+			Required []string `json:"required"`
+		}
+		if required == "" {
+			if prompt.schema != nil {
+				t.Errorf("text prompt (%s) has a schema", name)
+			}
+		} else if err := json.Unmarshal(prompt.schema, &schema); err != nil || !slices.Contains(schema.Required, required) {
+			t.Errorf("builtin prompt (%s) schema requires (%v), expected (%s)", name, schema.Required, required)
+		}
+	}
+
+	if rendered, err := prompts[textPromptName].render("abbey"); err != nil || rendered != "is this word obscure or uncommon, true or false? here is the word: abbey" {
+		t.Errorf("text prompt rendered (%s, %v)", rendered, err)
+	}
+}
+
+func TestLoadPromptsOverridesBuiltin(t *testing.T) {
+	dir := t.TempDir()
+	definition := "name: 'obscure'\nversion: 'obscure-v2'\nformat: 'text'\ntemplate: 'is {{.Word}} obscure?'\n"
+	if err := os.WriteFile(filepath.Join(dir, "obscure.yaml"), []byte(definition), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	prompts, err := LoadPrompts(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version := prompts[textPromptName].Version; version != "obscure-v2" {
+		t.Errorf("obscure prompt has version (%s), expected the prompt dir's", version)
+	}
+	if _, found := prompts[sensitivePromptName]; !found {
+		t.Errorf("builtin sensitive prompt is missing next to the prompt dir's")
+	}
+}
+
+func TestBatchPrompt(t *testing.T) {
+	dir := t.TempDir()
+	definition := "name: 'rate'\nversion: 'rate-v3'\nsystem: 'you rate words.'\ntemplate: 'rate {{.Word}}'\nbatchTemplate: 'rate {{.Words}}'\n"
+	if err := os.WriteFile(filepath.Join(dir, "rate.yaml"), []byte(definition), 0644); err != nil {
+		t.Fatal(err)
+	}
+	prompts, err := LoadPrompts(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	options := DefaultDetermineOptions()
+	options.Prompt = "rate"
+	if err := options.resolvePrompt(prompts); err != nil {
+		t.Fatal(err)
+	}
+	retry := DefaultRetryPolicy()
+	retry.MaxAttempts = 1
+
+	var asked llama.GenerateRequest
+	backend := llama.NewFakeBackend(func(request llama.GenerateRequest) string {
+		asked = request
+		return `{"verdicts": [{"word": "abbey", "obscure": false, "confidence": 0.9, "reasons": [], "definition": "a monastery"},
+			{"word": "aahed", "obscure": true, "confidence": 0.9, "reasons": ["slang"], "definition": "exclaimed"}]}`
+	})
+	determinations := NewBatchClassifier(backend, options, retry, nil, &RunStats{}).ClassifyBatch(context.Background(), []string{"abbey", "aahed"})
+
+	if asked.System != "you rate words." || asked.Prompt != "rate abbey, aahed" || asked.Template != "rate-v3" {
+		t.Errorf("batch asked with system (%s), prompt (%s), template (%s)", asked.System, asked.Prompt, asked.Template)
+	}
+	for i, expected := range []Decision{DecisionKeep, DecisionExclude} {
+		if determination := determinations[i]; determination.Decision != expected || determination.PromptVersion != "rate-v3" {
+			t.Errorf("batch word (%d) has decision (%s), prompt version (%s)", i, determination.Decision, determination.PromptVersion)
+		}
+	}
+
+	// a prompt without a batch template can't ask about a batch
+	if _, err := prompts[textPromptName].renderBatch([]string{"abbey", "aahed"}); err == nil {
+		t.Errorf("text prompt rendered a batch")
+	}
+}
@@ -0,0 +1,211 @@
+package curate
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"ozzysoft.net/wordle/pkg/llama"
+	"strings"
+	"unicode"
+)
+
+const (
+	properNounStage      = "proper_noun"
+	properNounPromptName = "proper-noun"
+)
+
+// ProperNounAsk sets which words the proper noun stage puts to the model.
+type ProperNounAsk string
+
+const (
+	// AskNever decides on the gazetteer alone.
+	AskNever ProperNounAsk = "never"
+	// AskGazetteer asks the model to confirm gazetteer entries only.
+	AskGazetteer ProperNounAsk = "gazetteer"
+	// AskAlways asks the model about every word without a common sense in the lexicon, one extra request per word.
+	AskAlways ProperNounAsk = "always"
+)
+
+// ProperNounConfig finds words that are only names and places.
+type ProperNounConfig struct {
+	Mode          StageMode        `yaml:"mode"`
+	Gazetteer     []string         `yaml:"gazetteer"`
+	Lexicon       []string         `yaml:"lexicon"`
+	Ask           ProperNounAsk    `yaml:"ask"`
+	MinConfidence float64          `yaml:"minConfidence"`
+	Determine     DetermineOptions `yaml:"determine"`
+}
+
+func DefaultProperNounConfig() ProperNounConfig {
+	determine := DefaultDetermineOptions()
+	determine.Prompt = properNounPromptName
+	return ProperNounConfig{
+		Mode:          StageExclude,
+		Gazetteer:     []string{"data/gazetteer.txt"},
+		Ask:           AskGazetteer,
+		MinConfidence: 0.7,
+		Determine:     determine,
+	}
+}
+
+// ProperNounVerdict is the structured answer to the proper noun question.
+type ProperNounVerdict struct {
+	ProperNoun  bool    `json:"proper_noun"`
+	CommonSense bool    `json:"common_sense"`
+	Kind        string  `json:"kind"`
+	Confidence  float64 `json:"confidence"`
+}
+
+// ProperNounStage tags (or excludes) words that are only proper nouns.
+type ProperNounStage struct {
+	config    ProperNounConfig
+	backend   llama.Backend
+	retry     RetryPolicy
+	gazetteer map[string]bool
+	common    map[string]bool
+}
+
+func NewProperNounStage(config ProperNounConfig, backend llama.Backend, retry RetryPolicy) (*ProperNounStage, error) {
+	switch config.Ask {
+	case AskNever, AskGazetteer, AskAlways:
+	default:
+		return nil, fmt.Errorf("proper noun stage has an unknown ask (%s), expected never, gazetteer or always", config.Ask)
+	}
+
+	gazetteer := make(map[string]bool)
+	for _, path := range config.Gazetteer {
+		if err := loadGazetteer(path, gazetteer); err != nil {
+			return nil, err
+		}
+	}
+
+	common := make(map[string]bool)
+	for _, path := range config.Lexicon {
+		if err := loadCasedLexicon(path, common, gazetteer); err != nil {
+			return nil, err
+		}
+	}
+
+	getLogger().Infof("proper noun stage, mode (%s), ask (%s), gazetteer names (%d), common words (%d)", config.Mode, config.Ask, len(gazetteer), len(common))
+	return &ProperNounStage{config: config, backend: backend, retry: retry, gazetteer: gazetteer, common: common}, nil
+}
+
+// loadGazetteer adds the lowercased names of the file, skipping blank lines and # comments.
+func loadGazetteer(path string, gazetteer map[string]bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open gazetteer (%s). %w", path, err)
+	}
+	defer doClose(f)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		name := strings.TrimSpace(scanner.Text())
+		if name == "" || strings.HasPrefix(name, "#") {
+			continue
+		}
+		gazetteer[strings.ToLower(name)] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read gazetteer (%s). %w", path, err)
+	}
+	return nil
+}
+
+// loadCasedLexicon adds the lowercase words of the file to common and the capitalized ones to proper, lowercased.
+func loadCasedLexicon(path string, common map[string]bool, proper map[string]bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open lexicon (%s). %w", path, err)
+	}
+	defer doClose(f)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		word := strings.TrimSpace(scanner.Text())
+		if isLowerWord(word) {
+			common[word] = true
+		} else if lower := strings.ToLower(word); word != "" && unicode.IsUpper(rune(word[0])) && isLowerWord(lower) {
+			proper[lower] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read lexicon (%s). %w", path, err)
+	}
+	return nil
+}
+
+func (s *ProperNounStage) Name() string {
+	return properNounStage
+}
+
+func (s *ProperNounStage) Inspect(ctx context.Context, word string) ([]Tag, *Determination) {
+	if s.common[word] {
+		return nil, nil
+	}
+
+	listed := s.gazetteer[word]
+	if s.config.Ask == AskNever || (s.config.Ask == AskGazetteer && !listed) {
+		if !listed {
+			return nil, nil
+		}
+		return fireTag(s.config.Mode, Tag{Stage: properNounStage, Rule: "gazetteer"}, &Determination{Response: "proper noun (gazetteer)"}, ReasonProperNoun, 1)
+	}
+
+	determination := determineWithRetry(ctx, s.retry, word, func(ctx context.Context) Determination {
+		return askStageQuestion(ctx, s.backend, s.config.Determine, word)
+	})
+	verdict, err := parseProperNounVerdict(determination.Response)
+	if determination.Err != nil || err != nil {
+		// the gazetteer still stands when the model can't be asked
+		getLogger().Warnf("word (%s), proper noun question failed, gazetteer listed (%t).  (%s)", word, listed, errors.Join(determination.Err, err))
+		if !listed {
+			return nil, nil
+		}
+		return fireTag(s.config.Mode, Tag{Stage: properNounStage, Rule: "gazetteer"}, &Determination{Response: "proper noun (gazetteer)"}, ReasonProperNoun, 1)
+	}
+
+	if !verdict.ProperNoun || verdict.CommonSense || verdict.Confidence < s.config.MinConfidence {
+		return nil, nil
+	}
+
+	rule := "model"
+	if listed {
+		rule = "gazetteer_model"
+	}
+	return fireTag(s.config.Mode, Tag{Stage: properNounStage, Rule: rule, Detail: verdict.Kind}, &determination, ReasonProperNoun, verdict.Confidence)
+}
+
+// parseProperNounVerdict decodes and validates a response against the proper noun schema.
+func parseProperNounVerdict(response string) (ProperNounVerdict, error) {
+	var raw rawProperNounVerdict
+	if err := decodeJSONAnswer(response, "proper noun verdict", &raw); err != nil {
+		return ProperNounVerdict{}, err
+	}
+
+	return ProperNounVerdict{ProperNoun: *raw.ProperNoun, CommonSense: *raw.CommonSense, Kind: *raw.Kind, Confidence: *raw.Confidence}, nil
+}
+
+// rawProperNounVerdict is the proper noun schema as decoded, a nil field was missing from the response.
+type rawProperNounVerdict struct {
+	ProperNoun  *bool    `json:"proper_noun"`
+	CommonSense *bool    `json:"common_sense"`
+	Kind        *string  `json:"kind"`
+	Confidence  *float64 `json:"confidence"`
+}
+
+func (raw *rawProperNounVerdict) validate() error {
+	switch {
+	case raw.ProperNoun == nil:
+		return missingField("proper_noun")
+	case raw.CommonSense == nil:
+		return missingField("common_sense")
+	case raw.Kind == nil:
+		return missingField("kind")
+	case raw.Confidence == nil:
+		return missingField("confidence")
+	}
+	return checkConfidence(*raw.Confidence)
+}
@@ -0,0 +1,125 @@
+package curate
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"ozzysoft.net/wordle/pkg/llama"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy controls how failed model calls are retried.  WordTimeout bounds all attempts for a single word.
+type RetryPolicy struct {
+	MaxAttempts    int           `yaml:"maxAttempts"`
+	InitialBackoff time.Duration `yaml:"initialBackoff"`
+	MaxBackoff     time.Duration `yaml:"maxBackoff"`
+	Multiplier     float64       `yaml:"multiplier"`
+	// Jitter is the fraction of each backoff that is randomized, 0.2 spreads a 1s backoff over 0.8s to 1.2s.
+	Jitter      float64       `yaml:"jitter"`
+	WordTimeout time.Duration `yaml:"wordTimeout"`
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: 500 * time.Millisecond,
+		MaxBackoff:     30 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+		WordTimeout:    5 * time.Minute,
+	}
+}
+
+// backoff returns the delay before the given retry, attempt 1 being the first retry.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(attempt-1))
+	d = math.Min(d, float64(p.MaxBackoff))
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(d)
+}
+
+// isRetryable returns true for failures that are likely to clear up on their own: the server being down or restarting,
+// timeouts, 5xx responses and the model still loading.  Anything else (bad request, unknown model) is permanent.
+func isRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, llama.ErrNotRecorded) {
+		return false
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var statusErr llama.StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= http.StatusInternalServerError || statusErr.StatusCode == http.StatusTooManyRequests
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	message := strings.ToLower(err.Error())
+	for _, s := range []string{"loading model", "model is loading", "server busy", "connection refused", "connection reset"} {
+		if strings.Contains(message, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// determineWithRetry calls determine until it produces an answer, the failure is permanent, the attempts are exhausted
+// or the word deadline passes.  Words that run out of attempts on a retryable failure are marked for the dead letter file.
+func determineWithRetry(ctx context.Context, policy RetryPolicy, word string, determine func(ctx context.Context) Determination) Determination {
+	logger := getLogger()
+
+	if policy.WordTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, policy.WordTimeout)
+		defer cancel()
+	}
+
+	attempts := max(policy.MaxAttempts, 1)
+	var determination Determination
+	for attempt := 1; ; attempt++ {
+		determination = determine(ctx)
+		determination.Attempts = attempt
+
+		if !isRetryable(determination.Err) {
+			return determination
+		}
+
+		if attempt >= attempts {
+			logger.Warnf("word (%s), retries exhausted after attempts (%d).  (%s)", word, attempt, determination.Err)
+			determination.DeadLetter = true
+			return determination
+		}
+
+		wait := policy.backoff(attempt)
+		logger.Infof("word (%s), attempt (%d) failed, retrying in (%s).  (%s)", word, attempt, wait, determination.Err)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			// a passed word deadline is retryable, a canceled run is not
+			determination.DeadLetter = errors.Is(ctx.Err(), context.DeadlineExceeded)
+			return determination
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package curate
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"ozzysoft.net/wordle/pkg/llama"
+	"slices"
+	"strings"
+)
+
+// ReviewConfig picks the words put to a person by the review command.
+type ReviewConfig struct {
+	MinConfidence float64 `yaml:"minConfidence"`
+	JournalPath   string  `yaml:"journalPath"`
+}
+
+func DefaultReviewConfig() ReviewConfig {
+	return ReviewConfig{MinConfidence: 0.7, JournalPath: "data/review.journal"}
+}
+
+// Why a word is queued for review.
+const (
+	ReviewUndetermined  = "undetermined"
+	ReviewLowConfidence = "low_confidence"
+	ReviewContradictory = "contradictory"
+)
+
+// ReviewItem is a word to review, with the decision it has now and what the model said about it.
+type ReviewItem struct {
+	Word       string
+	Why        string
+	Decision   Decision
+	Response   string
+	Definition string
+	Confidence *float64
+}
+
+// LoadReviewQueue lists the words to review in word order.
+func LoadReviewQueue(config Config) ([]ReviewItem, error) {
+	records, err := LoadResultRecords(config.ResultsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	responses, err := loadLegacyResponses(config)
+	if err != nil {
+		return nil, err
+	}
+
+	overrides, err := LoadOverrides(config.Overrides)
+	if err != nil {
+		return nil, err
+	}
+
+	reviewed, err := LoadJournal(config.Review.JournalPath)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make(map[string]ReviewItem)
+	for word, record := range records {
+		if item, queued := reviewRecord(record, config.Review.MinConfidence); queued {
+			items[word] = item
+		}
+	}
+
+	for word, legacy := range responses {
+		if _, found := records[word]; found {
+			if item, queued := items[word]; queued {
+				// the response files hold the answer as it was written, show it when there is one
+				item.Response = legacy.response
+				items[word] = item
+			}
+			continue
+		}
+		if item, queued := reviewLegacyResponse(word, legacy, config.Review.MinConfidence); queued {
+			items[word] = item
+		}
+	}
+
+	queue := make([]ReviewItem, 0, len(items))
+	for word, item := range items {
+		if _, found := overrides.Lookup(word); found {
+			continue
+		}
+		if _, found := reviewed[word]; found {
+			continue
+		}
+		queue = append(queue, item)
+	}
+	slices.SortFunc(queue, func(a, b ReviewItem) int { return strings.Compare(a.Word, b.Word) })
+
+	getLogger().Infof("review queue, results (%d), legacy responses (%d), queued words (%d), already reviewed (%d)", len(records), len(responses), len(queue), len(reviewed))
+	return queue, nil
+}
+
+// reviewRecord queues undetermined and low confidence results, results the ensemble or the cascade tiers split on, and
+// results whose explanation argues against their verdict.
+func reviewRecord(record ResultRecord, minConfidence float64) (ReviewItem, bool) {
+	item := ReviewItem{Word: record.Word, Decision: record.Decision, Response: record.Response}
+	if record.Verdict != nil {
+		item.Definition = record.Verdict.Definition
+		item.Confidence = &record.Verdict.Confidence
+	}
+
+	switch {
+	case record.Decision == DecisionUndetermined:
+		item.Why = ReviewUndetermined
+	case isDisagreement(record.Votes):
+		item.Why = ReviewContradictory
+	case contradictsRationale(record.Word, record.Response):
+		item.Why = ReviewContradictory
+	case record.Escalation != nil && record.Escalation.Decision.IsDecided() && record.Escalation.Decision != record.Decision:
+		item.Why = ReviewContradictory
+	case item.Confidence != nil && *item.Confidence < minConfidence:
+		item.Why = ReviewLowConfidence
+	default:
+		return item, false
+	}
+	return item, true
+}
+
+// reviewLegacyResponse queues a legacy response that doesn't parse, whose verdict doesn't match the file it is in, or
+// whose explanation argues against its verdict.
+func reviewLegacyResponse(word string, legacy legacyResponse, minConfidence float64) (ReviewItem, bool) {
+	item := ReviewItem{Word: word, Decision: legacy.decision, Response: legacy.response}
+	if legacy.decision == DecisionUndetermined {
+		item.Why = ReviewUndetermined
+		return item, true
+	}
+
+	decision := DecisionUndetermined
+	if verdict, err := parseJSONVerdict(legacy.response); err == nil {
+		decision = decisionFromBool(verdict.Obscure)
+		item.Definition = verdict.Definition
+		item.Confidence = &verdict.Confidence
+	} else {
+		decision, _ = parseTextVerdict(legacy.response)
+	}
+
+	switch {
+	case decision == DecisionUndetermined:
+		item.Why = ReviewUndetermined
+	case decision != legacy.decision, contradictsRationale(word, legacy.response):
+		item.Why = ReviewContradictory
+	case item.Confidence != nil && *item.Confidence < minConfidence:
+		item.Why = ReviewLowConfidence
+	default:
+		return item, false
+	}
+	return item, true
+}
+
+// legacyResponse is a response read from a legacy response file, with the decision of the file.
+type legacyResponse struct {
+	decision Decision
+	response string
+}
+
+// responseFile is a legacy response file and the decision of the words in it.
+type responseFile struct {
+	path     string
+	decision Decision
+}
+
+// loadLegacyResponses reads the curated, excluded and undetermined response files.
+func loadLegacyResponses(config Config) (map[string]legacyResponse, error) {
+	return readResponseFiles([]responseFile{
+		{config.CuratedResponsePath, DecisionKeep},
+		{config.ExcludedResponsePath, DecisionExclude},
+		{config.UndeterminedResponsePath, DecisionUndetermined},
+	}, inputWords(config))
+}
+
+// inputWords returns whether a word is in the input list, so a continuation line such as "note: ..." isn't taken for
+// an entry of a response file.  Without a readable input list it is nil, and entries are told apart by word length.
+func inputWords(config Config) func(word string) bool {
+	words, err := readWords(config.InputPath)
+	if err != nil {
+		getLogger().Debugf("reading response files without the input list.  (%s)", err)
+		return nil
+	}
+
+	known := make(map[string]bool, len(words))
+	for _, word := range words {
+		known[word] = true
+	}
+	return func(word string) bool { return known[word] }
+}
+
+// readResponseFiles reads the responses of the files, in order, so a word in more than one file takes the decision of
+// the last.  Missing files are skipped.  isWord tells entries from continuation lines, see llama.ScanLegacyResponses.
+func readResponseFiles(files []responseFile, isWord func(word string) bool) (map[string]legacyResponse, error) {
+	responses := make(map[string]legacyResponse)
+	for _, file := range files {
+		f, err := os.Open(file.path)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to open response file (%s). %w", file.path, err)
+		}
+
+		err = llama.ScanLegacyResponses(f, isWord, func(word string, response string) {
+			responses[word] = legacyResponse{decision: file.decision, response: response}
+		})
+		doClose(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response file (%s). %w", file.path, err)
+		}
+	}
+
+	return responses, nil
+}
+
+// RecordReview journals a reviewed word.
+func (j *Journal) RecordReview(word string, decision Decision) error {
+	return j.record(JournalEntry{Word: word, Decision: decision})
+}
@@ -0,0 +1,215 @@
+package curate
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"ozzysoft.net/wordle/pkg/llama"
+	"slices"
+	"strings"
+)
+
+const (
+	sensitiveStage      = "sensitive"
+	sensitivePromptName = "sensitive"
+)
+
+// SensitiveAsk sets which words the sensitive stage puts to the model.
+type SensitiveAsk string
+
+const (
+	// SensitiveAskNever decides on the blocklist alone.
+	SensitiveAskNever SensitiveAsk = "never"
+	// SensitiveAskCandidates asks the model about the words on the candidate lists, which have an innocent sense too.
+	SensitiveAskCandidates SensitiveAsk = "candidates"
+	// SensitiveAskAlways asks the model about every word that isn't blocklisted, one extra request per word.
+	SensitiveAskAlways SensitiveAsk = "always"
+)
+
+// SensitiveConfig screens out slurs, vulgar and otherwise inappropriate words.
+type SensitiveConfig struct {
+	Mode          StageMode        `yaml:"mode"`
+	Blocklist     []string         `yaml:"blocklist"`
+	Candidates    []string         `yaml:"candidates"`
+	Ask           SensitiveAsk     `yaml:"ask"`
+	MinConfidence float64          `yaml:"minConfidence"`
+	Determine     DetermineOptions `yaml:"determine"`
+}
+
+func DefaultSensitiveConfig() SensitiveConfig {
+	determine := DefaultDetermineOptions()
+	determine.Prompt = sensitivePromptName
+	return SensitiveConfig{
+		Mode:          StageExclude,
+		Blocklist:     []string{"data/blocklist.txt"},
+		Candidates:    []string{"data/sensitive-candidates.txt"},
+		Ask:           SensitiveAskCandidates,
+		MinConfidence: 0.5,
+		Determine:     determine,
+	}
+}
+
+// SensitiveVerdict is the structured answer to the sensitivity question.
+type SensitiveVerdict struct {
+	Sensitive  bool    `json:"sensitive"`
+	Category   string  `json:"category"`
+	Confidence float64 `json:"confidence"`
+}
+
+// SensitiveStage tags (or excludes) blocklisted words and words the model finds inappropriate.
+type SensitiveStage struct {
+	config     SensitiveConfig
+	backend    llama.Backend
+	retry      RetryPolicy
+	blocklist  wordList
+	candidates wordList
+}
+
+func NewSensitiveStage(config SensitiveConfig, backend llama.Backend, retry RetryPolicy) (*SensitiveStage, error) {
+	switch config.Ask {
+	case SensitiveAskNever, SensitiveAskCandidates, SensitiveAskAlways:
+	default:
+		return nil, fmt.Errorf("sensitive stage has an unknown ask (%s), expected never, candidates or always", config.Ask)
+	}
+
+	stage := &SensitiveStage{config: config, backend: backend, retry: retry, blocklist: newWordList(), candidates: newWordList()}
+	for _, path := range config.Blocklist {
+		if err := stage.blocklist.load(path, "blocklist"); err != nil {
+			return nil, err
+		}
+	}
+	if config.Ask == SensitiveAskCandidates {
+		for _, path := range config.Candidates {
+			if err := stage.candidates.load(path, "sensitive candidates"); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	getLogger().Infof("sensitive stage, mode (%s), ask (%s), blocklist words (%d), blocklist stems (%d), candidates (%d)",
+		config.Mode, config.Ask, len(stage.blocklist.words), len(stage.blocklist.stems), len(stage.candidates.words)+len(stage.candidates.stems))
+	return stage, nil
+}
+
+// wordList holds words, matching their inflected forms too, and stems matching every word starting with them.
+type wordList struct {
+	words map[string]bool
+	stems []string
+}
+
+func newWordList() wordList {
+	return wordList{words: make(map[string]bool)}
+}
+
+// load adds the lowercased words and stems of the file, skipping blank lines and # comments.
+func (l *wordList) load(path string, what string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s (%s). %w", what, path, err)
+	}
+	defer doClose(f)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		entry := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		if stem, found := strings.CutSuffix(entry, "*"); found {
+			l.stems = append(l.stems, stem)
+		} else {
+			l.words[entry] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read %s (%s). %w", what, path, err)
+	}
+	return nil
+}
+
+// match returns the rule suffix and entry matching word: the word itself, the base of an inflected form, then the stems.
+func (l *wordList) match(word string) (string, string, bool) {
+	if l.words[word] {
+		return "", word, true
+	}
+
+	for _, candidate := range inflectionCandidates(word) {
+		if l.words[candidate.base] {
+			return "_variant", candidate.base, true
+		}
+	}
+
+	if i := slices.IndexFunc(l.stems, func(stem string) bool { return strings.HasPrefix(word, stem) }); i >= 0 {
+		return "_stem", l.stems[i] + "*", true
+	}
+	return "", "", false
+}
+
+func (s *SensitiveStage) Name() string {
+	return sensitiveStage
+}
+
+func (s *SensitiveStage) Inspect(ctx context.Context, word string) ([]Tag, *Determination) {
+	if rule, entry, found := s.blocklist.match(word); found {
+		return fireTag(s.config.Mode, Tag{Stage: sensitiveStage, Rule: "blocklist" + rule, Detail: entry}, &Determination{Response: fmt.Sprintf("blocklisted (%s)", entry)}, ReasonOffensive, 1)
+	}
+
+	if s.config.Ask == SensitiveAskNever {
+		return nil, nil
+	}
+	if _, _, found := s.candidates.match(word); s.config.Ask == SensitiveAskCandidates && !found {
+		return nil, nil
+	}
+
+	determination := determineWithRetry(ctx, s.retry, word, func(ctx context.Context) Determination {
+		return askStageQuestion(ctx, s.backend, s.config.Determine, word)
+	})
+	verdict, err := parseSensitiveVerdict(determination.Response)
+	if determination.Err != nil || err != nil {
+		// an unchecked word is listed for confirmation, but left to the model
+		getLogger().Warnf("word (%s), sensitivity question failed.  (%s)", word, errors.Join(determination.Err, err))
+		return []Tag{{Stage: sensitiveStage, Rule: "unchecked"}}, nil
+	}
+
+	if !verdict.Sensitive || verdict.Confidence < s.config.MinConfidence {
+		return nil, nil
+	}
+
+	return fireTag(s.config.Mode, Tag{Stage: sensitiveStage, Rule: "model", Detail: verdict.Category}, &determination, ReasonOffensive, verdict.Confidence)
+}
+
+// parseSensitiveVerdict decodes and validates a response against the sensitivity schema.
+func parseSensitiveVerdict(response string) (SensitiveVerdict, error) {
+	var raw rawSensitiveVerdict
+	if err := decodeJSONAnswer(response, "sensitivity verdict", &raw); err != nil {
+		return SensitiveVerdict{}, err
+	}
+
+	return SensitiveVerdict{Sensitive: *raw.Sensitive, Category: *raw.Category, Confidence: *raw.Confidence}, nil
+}
+
+// rawSensitiveVerdict is the sensitivity schema as decoded, a nil field was missing from the response.
+type rawSensitiveVerdict struct {
+	Sensitive  *bool    `json:"sensitive"`
+	Category   *string  `json:"category"`
+	Confidence *float64 `json:"confidence"`
+}
+
+func (raw *rawSensitiveVerdict) validate() error {
+	switch {
+	case raw.Sensitive == nil:
+		return missingField("sensitive")
+	case raw.Category == nil:
+		return missingField("category")
+	case raw.Confidence == nil:
+		return missingField("confidence")
+	}
+	return checkConfidence(*raw.Confidence)
+}
+
+// isSensitive is true when the sensitive stage tagged the result.
+func isSensitive(tags []Tag) bool {
+	return slices.ContainsFunc(tags, func(tag Tag) bool { return tag.Stage == sensitiveStage })
+}
@@ -0,0 +1,71 @@
+package curate
+
+import (
+	"context"
+	"os"
+	"ozzysoft.net/wordle/pkg/llama"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestSensitiveAsk(t *testing.T) {
+	config := testConfig(t)
+	dir := t.TempDir()
+	blocklistPath, candidatesPath := filepath.Join(dir, "blocklist.txt"), filepath.Join(dir, "candidates.txt")
+	if err := os.WriteFile(blocklistPath, []byte("# blocked\nshit*\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(candidatesPath, []byte("screw\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config.Stages.Sensitive.Mode = StageExclude
+	config.Stages.Sensitive.Blocklist = []string{blocklistPath}
+	config.Stages.Sensitive.Candidates = []string{candidatesPath}
+	if err := config.resolvePrompts(); err != nil {
+		t.Fatal(err)
+	}
+
+	answers := newFakeAnswers(map[string]string{
+		"screw":  `{"sensitive":true,"category":"sexual","confidence":0.9}`,
+		"screws": `{"sensitive":false,"category":"none","confidence":0.9}`,
+		"apple":  `{"sensitive":false,"category":"none","confidence":0.9}`,
+	})
+	backend := llama.NewFakeBackend(answers.respond)
+
+	for _, c := range []struct {
+		ask      SensitiveAsk
+		excluded []string
+		asked    []string
+	}{
+		{SensitiveAskNever, []string{"shits"}, nil},
+		{SensitiveAskCandidates, []string{"shits", "screw"}, []string{"screw", "screws"}},
+		{SensitiveAskAlways, []string{"shits", "screw"}, []string{"screw", "screws", "apple"}},
+	} {
+		answers.requests = make(map[string]int)
+		sensitive := config.Stages.Sensitive
+		sensitive.Ask = c.ask
+		stage, err := NewSensitiveStage(sensitive, backend, config.Retry)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var excluded []string
+		for _, word := range []string{"shits", "screw", "screws", "apple"} {
+			if _, determination := stage.Inspect(context.Background(), word); determination != nil && determination.Decision == DecisionExclude {
+				excluded = append(excluded, word)
+			}
+		}
+		if !slices.Equal(excluded, c.excluded) {
+			t.Errorf("ask (%s) excluded (%v), expected (%v)", c.ask, excluded, c.excluded)
+		}
+		if answers.total() != len(c.asked) {
+			t.Errorf("ask (%s) asked (%v), expected (%v)", c.ask, answers.requests, c.asked)
+		}
+		for _, word := range c.asked {
+			if answers.requests[word] != 1 {
+				t.Errorf("ask (%s) asked about (%s) (%d) times, expected once", c.ask, word, answers.requests[word])
+			}
+		}
+	}
+}
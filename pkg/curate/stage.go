@@ -0,0 +1,205 @@
+package curate
+
+import (
+	"context"
+	"fmt"
+	"ozzysoft.net/wordle/pkg/llama"
+)
+
+// StageMode sets what a stage does with a word one of its rules fired for.
+type StageMode string
+
+const (
+	// StageExclude decides the word is excluded, the model isn't asked.
+	StageExclude StageMode = "exclude"
+	// StageFlag tags the word and leaves the decision to the model.
+	StageFlag StageMode = "flag"
+	// StagePass turns the stage off.
+	StagePass StageMode = "pass"
+)
+
+func (m StageMode) validate(stage string) error {
+	switch m {
+	case StageExclude, StageFlag, StagePass:
+		return nil
+	}
+	return fmt.Errorf("stage (%s) has an unknown mode (%s), expected exclude, flag or pass", stage, m)
+}
+
+// Tag records a stage rule that fired for a word, with the related word (such as the base of an inflection) when
+// there is one.
+type Tag struct {
+	Stage  string `json:"stage"`
+	Rule   string `json:"rule"`
+	Detail string `json:"detail,omitempty"`
+}
+
+func (t Tag) String() string {
+	if t.Detail == "" {
+		return fmt.Sprintf("%s:%s", t.Stage, t.Rule)
+	}
+	return fmt.Sprintf("%s:%s (%s)", t.Stage, t.Rule, t.Detail)
+}
+
+// Stage looks at a word before the model does.
+type Stage interface {
+	Name() string
+	Inspect(ctx context.Context, word string) ([]Tag, *Determination)
+}
+
+// StagesConfig configures the stages run ahead of the model, in order.
+type StagesConfig struct {
+	Sensitive  SensitiveConfig  `yaml:"sensitive"`
+	Morphology MorphologyConfig `yaml:"morphology"`
+	ProperNoun ProperNounConfig `yaml:"properNoun"`
+}
+
+func DefaultStagesConfig() StagesConfig {
+	return StagesConfig{Sensitive: DefaultSensitiveConfig(), Morphology: DefaultMorphologyConfig(), ProperNoun: DefaultProperNounConfig()}
+}
+
+// NewStages builds the stages that aren't turned off.
+func NewStages(backend llama.Backend, config Config) ([]Stage, error) {
+	var stages []Stage
+
+	sensitive := config.Stages.Sensitive
+	if err := sensitive.Mode.validate(sensitiveStage); err != nil {
+		return nil, err
+	}
+	if sensitive.Mode != StagePass {
+		stage, err := NewSensitiveStage(sensitive, backend, config.Retry)
+		if err != nil {
+			return nil, err
+		}
+		stages = append(stages, stage)
+	}
+
+	morphology := config.Stages.Morphology
+	if err := morphology.Mode.validate(morphologyStage); err != nil {
+		return nil, err
+	}
+	if morphology.Mode != StagePass {
+		stage, err := NewMorphologyStage(morphology, []string{config.InputPath, config.CuratedPath, config.ExcludedPath})
+		if err != nil {
+			return nil, err
+		}
+		stages = append(stages, stage)
+	}
+
+	properNoun := config.Stages.ProperNoun
+	if err := properNoun.Mode.validate(properNounStage); err != nil {
+		return nil, err
+	}
+	if properNoun.Mode != StagePass {
+		stage, err := NewProperNounStage(properNoun, backend, config.Retry)
+		if err != nil {
+			return nil, err
+		}
+		stages = append(stages, stage)
+	}
+
+	return stages, nil
+}
+
+// fireTag returns the tag of a stage rule that fired, with the determination excluding the word in exclude mode.
+func fireTag(mode StageMode, tag Tag, determination *Determination, reason ReasonCode, confidence float64) ([]Tag, *Determination) {
+	tags := []Tag{tag}
+	if mode != StageExclude {
+		return tags, nil
+	}
+
+	determination.Decision = DecisionExclude
+	determination.Reason = ReasonNone
+	determination.Verdict = &Verdict{Obscure: true, Confidence: confidence, Reasons: []ReasonCode{reason}}
+	return tags, determination
+}
+
+// inspectStages runs the stages in order until one decides the word.
+func inspectStages(ctx context.Context, stages []Stage, stats *RunStats, word string) ([]Tag, *Determination) {
+	var tags []Tag
+	for _, stage := range stages {
+		stageTags, determination := stage.Inspect(ctx, word)
+		for _, tag := range stageTags {
+			stats.recordTag(tag)
+		}
+		tags = append(tags, stageTags...)
+
+		if determination != nil {
+			determination.Tags = tags
+			return tags, determination
+		}
+	}
+	return tags, nil
+}
+
+// StagedClassifier runs the stages ahead of the classifier, which is only asked about words no stage decided.
+type StagedClassifier struct {
+	stages []Stage
+	next   Classifier
+	stats  *RunStats
+}
+
+func NewStagedClassifier(stages []Stage, next Classifier, stats *RunStats) Classifier {
+	if len(stages) == 0 {
+		return next
+	}
+	return &StagedClassifier{stages: stages, next: next, stats: stats}
+}
+
+func (c *StagedClassifier) Classify(ctx context.Context, word string) Determination {
+	tags, decided := inspectStages(ctx, c.stages, c.stats, word)
+	if decided != nil {
+		return *decided
+	}
+
+	determination := c.next.Classify(ctx, word)
+	determination.Tags = append(tags, determination.Tags...)
+	return determination
+}
+
+// askStageQuestion puts a stage's question about word to the model with the stage's prompt.
+func askStageQuestion(ctx context.Context, backend llama.Backend, options DetermineOptions, word string) Determination {
+	return askQuestion(ctx, backend, options, word, "")
+}
+
+// askQuestion puts the question of the options' prompt about word, and about an earlier response when there is one,
+// to the model.  The determination holds the answer, undecided.
+func askQuestion(ctx context.Context, backend llama.Backend, options DetermineOptions, word string, response string) Determination {
+	definition := options.prompt()
+	determination := Determination{
+		Decision:      DecisionUndetermined,
+		Reason:        ReasonEmpty,
+		Model:         options.model(),
+		PromptVersion: definition.Version,
+	}
+
+	prompt, err := definition.renderResponse(word, response)
+	if err != nil {
+		determination.Reason = ReasonUnparseable
+		determination.Err = err
+		return determination
+	}
+	determination.Prompt = prompt
+
+	resp, err := backend.Generate(ctx, llama.GenerateRequest{
+		Model:    determination.Model,
+		Prompt:   prompt,
+		System:   definition.System,
+		Subject:  word,
+		Template: definition.Version,
+		Format:   definition.schema,
+		Options:  options.promptOptions(),
+	})
+	if err != nil {
+		determination.Reason = reasonForError(err)
+		determination.Err = err
+		return determination
+	}
+
+	determination.Response = resp.Response
+	determination.Metrics = resp.Metrics
+	if resp.Model != "" {
+		determination.Model = resp.Model
+	}
+	return determination
+}
@@ -0,0 +1,150 @@
+package curate
+
+import (
+	"go.uber.org/zap"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RunStats accumulates counts over the results of a curation run, reported when the run ends.
+type RunStats struct {
+	results       atomic.Int64
+	curated       atomic.Int64
+	excluded      atomic.Int64
+	guessOnly     atomic.Int64
+	undetermined  atomic.Int64
+	overridden    atomic.Int64
+	deadLetters   atomic.Int64
+	ensembleWords atomic.Int64
+	disagreements atomic.Int64
+	escalations   atomic.Int64
+	evalTokens    atomic.Int64
+	tokensSaved   atomic.Int64
+	shortened     atomic.Int64
+	batches       atomic.Int64
+	batchRetries  atomic.Int64
+	tiers         sync.Map
+	tags          sync.Map
+}
+
+func (s *RunStats) record(result CurateResult) {
+	s.results.Add(1)
+	switch result.decision {
+	case DecisionKeep:
+		s.curated.Add(1)
+	case DecisionExclude:
+		s.excluded.Add(1)
+	case DecisionGuessOnly:
+		s.guessOnly.Add(1)
+	default:
+		s.undetermined.Add(1)
+	}
+	if result.override != nil {
+		s.overridden.Add(1)
+	}
+	if result.deadLetter {
+		s.deadLetters.Add(1)
+	}
+
+	s.evalTokens.Add(int64(result.metrics.EvalCount))
+	if result.tokensSaved > 0 {
+		s.shortened.Add(1)
+		s.tokensSaved.Add(int64(result.tokensSaved))
+	}
+
+	if len(result.votes) > 1 {
+		s.ensembleWords.Add(1)
+		if isDisagreement(result.votes) {
+			s.disagreements.Add(1)
+		}
+	}
+}
+
+// counts returns the decision counts so far.
+func (s *RunStats) counts() RunCounts {
+	return RunCounts{
+		Processed:    s.results.Load(),
+		Curated:      s.curated.Load(),
+		Excluded:     s.excluded.Load(),
+		GuessOnly:    s.guessOnly.Load(),
+		Undetermined: s.undetermined.Load(),
+		Overridden:   s.overridden.Load(),
+		DeadLetters:  s.deadLetters.Load(),
+	}
+}
+
+func (s *RunStats) recordBatch() {
+	s.batches.Add(1)
+}
+
+func (s *RunStats) recordBatchRetry() {
+	s.batchRetries.Add(1)
+}
+
+// recordTag counts a stage rule firing.
+func (s *RunStats) recordTag(tag Tag) {
+	value, _ := s.tags.LoadOrStore(tag.Stage+":"+tag.Rule, &atomic.Int64{})
+	value.(*atomic.Int64).Add(1)
+}
+
+func (s *RunStats) recordEscalation() {
+	s.escalations.Add(1)
+}
+
+func (s *RunStats) recordTier(tier string, latency time.Duration) {
+	value, _ := s.tiers.LoadOrStore(tier, &tierStats{})
+	t := value.(*tierStats)
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.count++
+	t.latency += latency
+}
+
+func (s *RunStats) report(logger *zap.SugaredLogger) {
+	logger.Infof("run stats, results (%d)", s.results.Load())
+
+	if ensembleWords := s.ensembleWords.Load(); ensembleWords > 0 {
+		disagreements := s.disagreements.Load()
+		logger.Infof("ensemble disagreement, words (%d), disagreements (%d), rate (%f)", ensembleWords, disagreements, float64(disagreements)/float64(ensembleWords))
+	}
+
+	if shortened := s.shortened.Load(); shortened > 0 {
+		logger.Infof("early exit, shortened answers (%d), answer tokens (%d), estimated tokens saved (%d)", shortened, s.evalTokens.Load(), s.tokensSaved.Load())
+	}
+
+	if batches := s.batches.Load(); batches > 0 {
+		logger.Infof("batches (%d), malformed or partial batches retried (%d)", batches, s.batchRetries.Load())
+	}
+
+	s.tags.Range(func(key, value any) bool {
+		logger.Infof("stage rule (%s), words (%d)", key, value.(*atomic.Int64).Load())
+		return true
+	})
+
+	fastCount := int64(0)
+	s.tiers.Range(func(key, value any) bool {
+		t := value.(*tierStats)
+		t.mutex.Lock()
+		defer t.mutex.Unlock()
+
+		if key == tierFast {
+			fastCount = t.count
+		}
+		logger.Infof("cascade tier (%s), words (%d), average latency milliseconds (%f)", key, t.count, milliseconds(t.latency)/float64(max(t.count, 1)))
+		return true
+	})
+
+	if fastCount > 0 {
+		escalations := s.escalations.Load()
+		logger.Infof("cascade escalations (%d), rate (%f)", escalations, float64(escalations)/float64(fastCount))
+	}
+}
+
+// tierStats accumulates the per tier counts and latency of a cascade.
+type tierStats struct {
+	mutex   sync.Mutex
+	count   int64
+	latency time.Duration
+}
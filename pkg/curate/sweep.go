@@ -0,0 +1,345 @@
+package curate
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"ozzysoft.net/wordle/pkg/llama"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SweepConfig is the grid of a sweep, every combination of model, prompt, temperature, seed and batch size is a cell
+// run over the same sample of the input words.  An empty dimension leaves the determine setting as configured.
+type SweepConfig struct {
+	Models       []string  `yaml:"models"`
+	Prompts      []string  `yaml:"prompts"`
+	Temperatures []float64 `yaml:"temperatures"`
+	Seeds        []int     `yaml:"seeds"`
+	BatchSizes   []int     `yaml:"batchSizes"`
+	// SampleSize words are drawn from the input with SampleSeed, so every cell (and a resumed sweep) sees the same words.
+	SampleSize int    `yaml:"sampleSize"`
+	SampleSeed uint64 `yaml:"sampleSeed"`
+	// Dir holds one result file per completed cell, a rerun skips the cells already there.
+	Dir string `yaml:"dir"`
+	// Examples is the number of disagreement examples kept per cell.
+	Examples int `yaml:"examples"`
+}
+
+func DefaultSweepConfig() SweepConfig {
+	return SweepConfig{SampleSize: 200, SampleSeed: 1, Dir: "data/sweep", Examples: 5}
+}
+
+// SweepCell is one combination of the grid.
+type SweepCell struct {
+	Model       string   `json:"model,omitempty"`
+	Prompt      string   `json:"prompt,omitempty"`
+	Temperature *float64 `json:"temperature,omitempty"`
+	Seed        *int     `json:"seed,omitempty"`
+	// BatchSize is zero for single word requests.
+	BatchSize int `json:"batch_size,omitempty"`
+}
+
+// ID names the cell's result file.
+func (c SweepCell) ID() string {
+	parts := []string{c.Model, c.Prompt}
+	if c.Temperature != nil {
+		parts = append(parts, "t="+strconv.FormatFloat(*c.Temperature, 'g', -1, 64))
+	}
+	if c.Seed != nil {
+		parts = append(parts, "seed="+strconv.Itoa(*c.Seed))
+	}
+	if c.BatchSize > 0 {
+		parts = append(parts, "batch="+strconv.Itoa(c.BatchSize))
+	}
+	return strings.NewReplacer("/", "_", ":", "_", " ", "_").Replace(strings.Join(parts, ","))
+}
+
+// SweepResult is the outcome of a cell.
+type SweepResult struct {
+	Cell       SweepCell  `json:"cell"`
+	SampleHash string     `json:"sample_hash"`
+	Labeled    int        `json:"labeled"`
+	Agreement  float64    `json:"agreement"`
+	Throughput float64    `json:"words_per_second"`
+	Report     EvalReport `json:"report"`
+}
+
+// Cells expands the grid.
+func (s SweepConfig) Cells() []SweepCell {
+	models := s.Models
+	if len(models) == 0 {
+		models = []string{""}
+	}
+	prompts := s.Prompts
+	if len(prompts) == 0 {
+		prompts = []string{""}
+	}
+	temperatures := []*float64{nil}
+	if len(s.Temperatures) > 0 {
+		temperatures = temperatures[:0]
+		for _, t := range s.Temperatures {
+			temperatures = append(temperatures, &t)
+		}
+	}
+	seeds := []*int{nil}
+	if len(s.Seeds) > 0 {
+		seeds = seeds[:0]
+		for _, seed := range s.Seeds {
+			seeds = append(seeds, &seed)
+		}
+	}
+
+	batchSizes := s.BatchSizes
+	if len(batchSizes) == 0 {
+		batchSizes = []int{0}
+	}
+
+	var cells []SweepCell
+	for _, model := range models {
+		for _, prompt := range prompts {
+			for _, temperature := range temperatures {
+				for _, seed := range seeds {
+					for _, batchSize := range batchSizes {
+						cells = append(cells, SweepCell{Model: model, Prompt: prompt, Temperature: temperature, Seed: seed, BatchSize: batchSize})
+					}
+				}
+			}
+		}
+	}
+	return cells
+}
+
+// Sweep runs every cell of the grid that has no result yet over the sample, through the same workers as Curate, and
+// returns the results of all cells.  The cascade and ensemble are turned off, each cell is a single model.
+func Sweep(ctx context.Context, backend llama.Backend, config Config) ([]SweepResult, error) {
+	logger := getLogger()
+	sweep := config.Sweep
+
+	reference, err := loadReferenceLabels(config.CuratedPath, config.ExcludedPath)
+	if err != nil {
+		return nil, err
+	}
+
+	words, err := sampleWords(config.InputPath, sweep.SampleSize, sweep.SampleSeed)
+	if err != nil {
+		return nil, err
+	}
+	sampleHash := hashWords(words)
+
+	gold := make([]GoldWord, 0, len(words))
+	for _, word := range words {
+		if decision, found := reference[word]; found {
+			gold = append(gold, GoldWord{Word: word, Expected: decision})
+		}
+	}
+
+	if err := os.MkdirAll(sweep.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create sweep dir (%s). %w", sweep.Dir, err)
+	}
+
+	cells := sweep.Cells()
+	logger.Infof("sweep, cells (%d), sample words (%d), labeled words (%d), sample (%s)", len(cells), len(words), len(gold), sampleHash[:12])
+
+	results := make([]SweepResult, 0, len(cells))
+	for i, cell := range cells {
+		cellConfig, cell, err := applySweepCell(config, cell)
+		if err != nil {
+			return results, err
+		}
+
+		path := filepath.Join(sweep.Dir, cell.ID()+".json")
+		if result, err := loadSweepResult(path); err == nil && result.SampleHash == sampleHash {
+			logger.Infof("sweep cell (%d) of (%d), (%s) already complete", i+1, len(cells), cell.ID())
+			results = append(results, result)
+			continue
+		}
+
+		logger.Infof("sweep cell (%d) of (%d), (%s)", i+1, len(cells), cell.ID())
+		result, err := runSweepCell(ctx, backend, cellConfig, cell, words, gold)
+		if err != nil {
+			return results, err
+		}
+		result.SampleHash = sampleHash
+
+		if err := writeJSONFile(path, result); err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// applySweepCell returns the config for the cell, and the cell with the settings it left as configured filled in, so
+// its ID identifies what actually ran.  The prompt is identified by its version.
+func applySweepCell(config Config, cell SweepCell) (Config, SweepCell, error) {
+	config.Cascade.Enabled = false
+	config.Ensemble.Voters = nil
+	if cell.Model != "" {
+		config.Determine.Model = cell.Model
+	}
+	if cell.Prompt != "" {
+		config.Determine.Prompt = cell.Prompt
+	}
+	if cell.Temperature != nil {
+		config.Determine.Temperature = cell.Temperature
+	}
+	if cell.Seed != nil {
+		config.Determine.Seed = cell.Seed
+	}
+	if cell.BatchSize > 0 {
+		config.Batch.Size = cell.BatchSize
+	}
+	if err := config.resolvePrompts(); err != nil {
+		return config, cell, err
+	}
+
+	return config, SweepCell{
+		Model:       config.Determine.model(),
+		Prompt:      config.Determine.prompt().Version,
+		Temperature: config.Determine.Temperature,
+		Seed:        config.Determine.Seed,
+		BatchSize:   batchSize(config.Batch),
+	}, nil
+}
+
+func runSweepCell(ctx context.Context, backend llama.Backend, config Config, cell SweepCell, words []string, gold []GoldWord) (SweepResult, error) {
+	start := time.Now()
+	results, interrupted, err := classifyWords(ctx, backend, config, &RunStats{}, words)
+	if err != nil {
+		return SweepResult{}, err
+	}
+	if interrupted {
+		// a partial cell isn't written, so the next sweep runs it again
+		return SweepResult{}, ctx.Err()
+	}
+	elapsed := time.Since(start)
+
+	prompt := config.Determine.prompt()
+	report := scoreResults(gold, results)
+	report.Prompt = prompt.Name
+	report.PromptVersion = prompt.Version
+	report.Model = config.Determine.model()
+	report.Options = config.Determine.promptOptions()
+	report.BatchSize = max(config.Batch.Size, 1)
+	report.ElapsedMs = milliseconds(elapsed)
+	report.Timestamp = time.Now()
+	report.Name = cell.ID()
+
+	// parse failures and latency cover every sampled word, not only the labeled ones
+	parseFailures := 0
+	for _, result := range results {
+		if result.reason == ReasonUnparseable || result.reason == ReasonEmpty {
+			parseFailures++
+		}
+	}
+	report.ParseFailures = parseFailures
+	report.ParseFailureRate = ratio(parseFailures, len(results))
+
+	if len(report.Misses) > config.Sweep.Examples {
+		report.Misses = report.Misses[:config.Sweep.Examples]
+	}
+
+	return SweepResult{
+		Cell:       cell,
+		Labeled:    report.Words,
+		Agreement:  report.Accuracy,
+		Throughput: float64(len(results)) / elapsed.Seconds(),
+		Report:     report,
+	}, nil
+}
+
+// batchSize is the cell batch size of the batch settings, zero when words are asked about one at a time.
+func batchSize(batch BatchConfig) int {
+	if batch.Size > 1 {
+		return batch.Size
+	}
+	return 0
+}
+
+// loadReferenceLabels reads the curated and excluded word lists as keep and exclude labels.
+func loadReferenceLabels(curatedPath string, excludedPath string) (map[string]Decision, error) {
+	labels := make(map[string]Decision)
+	for path, decision := range map[string]Decision{curatedPath: DecisionKeep, excludedPath: DecisionExclude} {
+		words, err := readWords(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, word := range words {
+			labels[word] = decision
+		}
+	}
+	return labels, nil
+}
+
+// sampleWords draws size words from the word file with a seeded shuffle, all of them when size isn't positive.
+func sampleWords(path string, size int, seed uint64) ([]string, error) {
+	words, err := readWords(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r := rand.New(rand.NewPCG(seed, seed))
+	r.Shuffle(len(words), func(i, j int) {
+		words[i], words[j] = words[j], words[i]
+	})
+
+	if size > 0 && size < len(words) {
+		words = words[:size]
+	}
+	return words, nil
+}
+
+// readWords reads one word per line, skipping blank lines.
+func readWords(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open word file (%s). %w", path, err)
+	}
+	defer doClose(f)
+
+	var words []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if word := normalizeWord(scanner.Text()); word != "" {
+			words = append(words, word)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read word file (%s). %w", path, err)
+	}
+	return words, nil
+}
+
+func hashWords(words []string) string {
+	h := sha256.New()
+	for _, word := range words {
+		h.Write([]byte(word))
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func loadSweepResult(path string) (SweepResult, error) {
+	var result SweepResult
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return result, err
+	}
+	if err := json.Unmarshal(b, &result); err != nil {
+		return result, fmt.Errorf("failed to unmarshal sweep result (%s). %w", path, err)
+	}
+	if result.SampleHash == "" {
+		return result, errors.New("sweep result has no sample hash")
+	}
+	return result, nil
+}
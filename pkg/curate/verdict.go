@@ -0,0 +1,130 @@
+package curate
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ResponseFormat selects how the model is asked to answer.
+type ResponseFormat string
+
+const (
+	// FormatJSON constrains the model to the verdict json schema.
+	FormatJSON ResponseFormat = "json"
+	// FormatText is the original free text prompt, answered with a leading "True" or "False" sentence.
+	FormatText ResponseFormat = "text"
+)
+
+// ReasonCode explains why the model considers a word obscure.
+type ReasonCode string
+
+const (
+	ReasonArchaic     ReasonCode = "archaic"
+	ReasonProperNoun  ReasonCode = "proper_noun"
+	ReasonPlural      ReasonCode = "plural"
+	ReasonMisspelling ReasonCode = "misspelling"
+	ReasonTechnical   ReasonCode = "technical"
+	ReasonSlang       ReasonCode = "slang"
+	ReasonForeign     ReasonCode = "foreign"
+	ReasonOffensive   ReasonCode = "offensive"
+)
+
+var reasonCodes = []ReasonCode{ReasonArchaic, ReasonProperNoun, ReasonPlural, ReasonMisspelling, ReasonTechnical, ReasonSlang, ReasonForeign, ReasonOffensive}
+
+// Verdict is the structured answer to the obscure word question.
+type Verdict struct {
+	Obscure    bool         `json:"obscure"`
+	Confidence float64      `json:"confidence"`
+	Reasons    []ReasonCode `json:"reasons"`
+	Definition string       `json:"definition"`
+}
+
+// verdictSchema is passed as the generate request format, so the backend constrains the output to it.
+var verdictSchema = json.RawMessage(fmt.Sprintf(`{
+  "type": "object",
+  "properties": {
+    "obscure": {"type": "boolean"},
+    "confidence": {"type": "number", "minimum": 0, "maximum": 1},
+    "reasons": {"type": "array", "items": {"type": "string", "enum": [%s]}},
+    "definition": {"type": "string"}
+  },
+  "required": ["obscure", "confidence", "reasons", "definition"]
+}`, quotedReasonCodes()))
+
+func quotedReasonCodes() string {
+	quoted := make([]string, len(reasonCodes))
+	for i, code := range reasonCodes {
+		quoted[i] = fmt.Sprintf("%q", code)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// parseJSONVerdict decodes and validates a response against the verdict schema.
+func parseJSONVerdict(response string) (Verdict, error) {
+	var raw rawVerdict
+	if err := decodeJSONAnswer(response, "verdict", &raw); err != nil {
+		return Verdict{}, err
+	}
+
+	for _, reason := range raw.Reasons {
+		if !slices.Contains(reasonCodes, reason) {
+			return Verdict{}, fmt.Errorf("verdict reason (%s) is not a known reason code", reason)
+		}
+	}
+
+	return Verdict{Obscure: *raw.Obscure, Confidence: *raw.Confidence, Reasons: raw.Reasons, Definition: *raw.Definition}, nil
+}
+
+// rawVerdict is the verdict schema as decoded, a nil field was missing from the response.
+type rawVerdict struct {
+	Obscure    *bool        `json:"obscure"`
+	Confidence *float64     `json:"confidence"`
+	Reasons    []ReasonCode `json:"reasons"`
+	Definition *string      `json:"definition"`
+}
+
+func (raw *rawVerdict) validate() error {
+	switch {
+	case raw.Obscure == nil:
+		return missingField("obscure")
+	case raw.Confidence == nil:
+		return missingField("confidence")
+	case raw.Reasons == nil:
+		return missingField("reasons")
+	case raw.Definition == nil:
+		return missingField("definition")
+	}
+	return checkConfidence(*raw.Confidence)
+}
+
+// jsonAnswer is the decoded json answer of a prompt, validate checks every required field is present and in range.
+type jsonAnswer interface {
+	validate() error
+}
+
+// decodeJSONAnswer strictly decodes the json answer of a prompt into raw and validates it.
+func decodeJSONAnswer(response string, what string, raw jsonAnswer) error {
+	decoder := json.NewDecoder(strings.NewReader(response))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(raw); err != nil {
+		return fmt.Errorf("invalid %s json. %w", what, err)
+	}
+
+	if err := raw.validate(); err != nil {
+		return fmt.Errorf("%s %w", what, err)
+	}
+	return nil
+}
+
+func missingField(name string) error {
+	return fmt.Errorf("is missing the required field (%s)", name)
+}
+
+func checkConfidence(confidence float64) error {
+	if confidence < 0 || confidence > 1 {
+		return fmt.Errorf("confidence (%f) is out of range", confidence)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package curate
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseJSONAnswers(t *testing.T) {
+	for _, c := range []struct {
+		response string
+		parse    func(string) error
+		expected string
+	}{
+		{`{"obscure":true,"confidence":0.9,"reasons":["archaic"],"definition":"old"}`, parseVerdictErr, ""},
+		{`{"obscure":true,"confidence":0.9,"definition":"old"}`, parseVerdictErr, "verdict is missing the required field (reasons)"},
+		{`{"obscure":true,"confidence":0.9,"reasons":[],"definition":"old","extra":1}`, parseVerdictErr, "invalid verdict json"},
+		{`{"obscure":true,"confidence":0.9,"reasons":["made_up"],"definition":"old"}`, parseVerdictErr, "not a known reason code"},
+		{`{"sensitive":true,"category":"vulgar","confidence":0.8}`, parseSensitiveErr, ""},
+		{`{"sensitive":true,"confidence":0.8}`, parseSensitiveErr, "sensitivity verdict is missing the required field (category)"},
+		{`{"sensitive":true,"category":"vulgar","confidence":1.5}`, parseSensitiveErr, "sensitivity verdict confidence (1.500000) is out of range"},
+		{`{"proper_noun":true,"common_sense":false,"kind":"given name","confidence":0.7}`, parseProperNounErr, ""},
+		{`{"proper_noun":true,"kind":"given name","confidence":0.7}`, parseProperNounErr, "proper noun verdict is missing the required field (common_sense)"},
+		{`{"consistent":false,"confidence":-0.1}`, parseConsistencyErr, "consistency judgement confidence (-0.100000) is out of range"},
+		{`True. Not json.`, parseConsistencyErr, "invalid consistency judgement json"},
+	} {
+		err := c.parse(c.response)
+		if c.expected == "" && err != nil || c.expected != "" && (err == nil || !strings.Contains(err.Error(), c.expected)) {
+			t.Errorf("response (%s) parsed with error (%v), expected (%s)", c.response, err, c.expected)
+		}
+	}
+}
+
+func parseVerdictErr(response string) error {
+	_, err := parseJSONVerdict(response)
+	return err
+}
+
+func parseSensitiveErr(response string) error {
+	_, err := parseSensitiveVerdict(response)
+	return err
+}
+
+func parseProperNounErr(response string) error {
+	_, err := parseProperNounVerdict(response)
+	return err
+}
+
+func parseConsistencyErr(response string) error {
+	_, err := parseConsistencyJudgement(response)
+	return err
+}
+
+func TestFireTag(t *testing.T) {
+	tag := Tag{Stage: properNounStage, Rule: "model", Detail: "given name"}
+	if tags, determination := fireTag(StageFlag, tag, &Determination{}, ReasonProperNoun, 0.8); len(tags) != 1 || determination != nil {
+		t.Errorf("flag mode returned tags (%v), determination (%v)", tags, determination)
+	}
+
+	_, determination := fireTag(StageExclude, tag, &Determination{}, ReasonProperNoun, 0.8)
+	if determination == nil || determination.Decision != DecisionExclude {
+		t.Fatalf("exclude mode returned determination (%v)", determination)
+	}
+	if verdict := determination.Verdict; verdict.Definition != "" || verdict.Confidence != 0.8 || len(verdict.Reasons) != 1 || verdict.Reasons[0] != ReasonProperNoun {
+		t.Errorf("exclude mode verdict (%+v), expected the reason and confidence without a definition", verdict)
+	}
+}
+
+func TestParsePartialVerdict(t *testing.T) {
+	ready := verdictReady(FormatJSON)
+	for _, c := range []struct {
+		response   string
+		ready      bool
+		reasons    []ReasonCode
+		definition string
+	}{
+		{`{"obscure": true, "confidence": 0.9,`, false, nil, ""},
+		{`{"obscure": true, "confidence": 0.9, "reasons": ["archaic", "sla`, false, nil, ""},
+		{`{"obscure": true, "confidence": 0.9, "reasons": ["archaic", "slang"], "defin`, true, []ReasonCode{"archaic", "slang"}, ""},
+		{`{"confidence": 0.2, "reasons": [], "definition": "a \"quoted\" word", "obscure": false`, true, []ReasonCode{}, `a "quoted" word`},
+		{`{"obscure": true, "confidence": 0.9, "reasons": ["made_up"], "defin`, false, nil, ""},
+	} {
+		if actual := ready(c.response); actual != c.ready {
+			t.Errorf("response (%s) ready (%t), expected (%t)", c.response, actual, c.ready)
+		}
+		if !c.ready {
+			continue
+		}
+
+		verdict, err := parsePartialVerdict(c.response)
+		if err != nil || !slices.Equal(verdict.Reasons, c.reasons) || verdict.Definition != c.definition {
+			t.Errorf("response (%s) parsed reasons (%v), definition (%s), error (%v)", c.response, verdict.Reasons, verdict.Definition, err)
+		}
+	}
+}
@@ -0,0 +1,329 @@
+package llama
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	ollama "github.com/ollama/ollama/api"
+	"go.uber.org/zap"
+	"net/url"
+	"ozzysoft.net/wordle/pkg/log"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Backend is a language model server, or a stand in for one.
+type Backend interface {
+	Name() string
+	Generate(ctx context.Context, request GenerateRequest) (GenerateResponse, error)
+	Chat(ctx context.Context, request ChatRequest) (ChatResponse, error)
+	Classify(ctx context.Context, request ClassifyRequest) (ClassifyResponse, error)
+	Embed(ctx context.Context, request EmbedRequest) (EmbedResponse, error)
+}
+
+// Metrics are the timings and token counts reported for a generation, where the backend provides them.
+type Metrics struct {
+	TotalDuration      time.Duration `json:"total_duration"`
+	LoadDuration       time.Duration `json:"load_duration"`
+	PromptEvalCount    int           `json:"prompt_eval_count"`
+	PromptEvalDuration time.Duration `json:"prompt_eval_duration"`
+	EvalCount          int           `json:"eval_count"`
+	EvalDuration       time.Duration `json:"eval_duration"`
+}
+
+func (m Metrics) Add(other Metrics) Metrics {
+	return Metrics{
+		TotalDuration:      m.TotalDuration + other.TotalDuration,
+		LoadDuration:       m.LoadDuration + other.LoadDuration,
+		PromptEvalCount:    m.PromptEvalCount + other.PromptEvalCount,
+		PromptEvalDuration: m.PromptEvalDuration + other.PromptEvalDuration,
+		EvalCount:          m.EvalCount + other.EvalCount,
+		EvalDuration:       m.EvalDuration + other.EvalDuration,
+	}
+}
+
+// GenerateRequest is a single prompt completion.
+type GenerateRequest struct {
+	Model    string
+	System   string
+	Prompt   string
+	Subject  string
+	Template string
+	Format   json.RawMessage
+	Options  map[string]interface{}
+	Until    func(response string) bool
+}
+
+// GenerateResponse is the model answer.
+type GenerateResponse struct {
+	Model    string
+	Response string
+	Metrics  Metrics
+	Stopped  bool
+}
+
+// ChatMessage is one message of a chat, Role is system, user or assistant.
+type ChatMessage struct {
+	Role    string
+	Content string
+}
+
+// ChatRequest is a chat completion.  Subject, Template, Format and Options are as for GenerateRequest.
+type ChatRequest struct {
+	Model    string
+	Messages []ChatMessage
+	Subject  string
+	Template string
+	Format   json.RawMessage
+	Options  map[string]interface{}
+}
+
+type ChatResponse struct {
+	Model   string
+	Message ChatMessage
+	Metrics Metrics
+}
+
+// ClassifyRequest asks the model to pick one of the labels for the prompt.
+type ClassifyRequest struct {
+	Model   string
+	System  string
+	Prompt  string
+	Labels  []string
+	Options map[string]interface{}
+}
+
+type ClassifyResponse struct {
+	Model    string
+	Label    string
+	Response string
+	Metrics  Metrics
+}
+
+type EmbedRequest struct {
+	Model string
+	Input []string
+}
+
+type EmbedResponse struct {
+	Model      string
+	Embeddings [][]float32
+}
+
+// StatusError is an http error response from a backend server.
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e StatusError) Error() string {
+	return fmt.Sprintf("backend status (%d). %s", e.StatusCode, e.Message)
+}
+
+// chatAsGenerate flattens a chat into a single prompt, system messages become the system prompt.
+func chatAsGenerate(request ChatRequest) GenerateRequest {
+	var system, prompt []string
+	for _, message := range request.Messages {
+		if message.Role == "system" {
+			system = append(system, message.Content)
+		} else {
+			prompt = append(prompt, message.Content)
+		}
+	}
+
+	return GenerateRequest{
+		Model:    request.Model,
+		System:   strings.Join(system, "\n\n"),
+		Prompt:   strings.Join(prompt, "\n\n"),
+		Subject:  request.Subject,
+		Template: request.Template,
+		Format:   request.Format,
+		Options:  request.Options,
+	}
+}
+
+// chatWithGenerate implements Chat on top of Generate, for backends without a chat api.
+func chatWithGenerate(ctx context.Context, backend Backend, request ChatRequest) (ChatResponse, error) {
+	response, err := backend.Generate(ctx, chatAsGenerate(request))
+	return ChatResponse{Model: response.Model, Message: ChatMessage{Role: "assistant", Content: response.Response}, Metrics: response.Metrics}, err
+}
+
+// classifyWithGenerate implements Classify on top of Generate, constraining the response to the labels with a schema.
+func classifyWithGenerate(ctx context.Context, backend Backend, request ClassifyRequest) (ClassifyResponse, error) {
+	if len(request.Labels) == 0 {
+		return ClassifyResponse{}, fmt.Errorf("classify request has no labels")
+	}
+
+	labels, err := json.Marshal(request.Labels)
+	if err != nil {
+		return ClassifyResponse{}, fmt.Errorf("failed to marshal classify labels. %w", err)
+	}
+
+	schema := fmt.Sprintf(`{"type": "object", "properties": {"label": {"type": "string", "enum": %s}}, "required": ["label"]}`, labels)
+	response, err := backend.Generate(ctx, GenerateRequest{
+		Model:   request.Model,
+		System:  request.System,
+		Prompt:  fmt.Sprintf("%s\nanswer in json with a label, one of: %s", request.Prompt, strings.Join(request.Labels, ", ")),
+		Format:  json.RawMessage(schema),
+		Options: request.Options,
+	})
+	if err != nil {
+		return ClassifyResponse{}, err
+	}
+
+	result := ClassifyResponse{Model: response.Model, Response: response.Response, Metrics: response.Metrics}
+	var answer struct {
+		Label string `json:"label"`
+	}
+	if err := json.Unmarshal([]byte(response.Response), &answer); err != nil {
+		return result, fmt.Errorf("invalid classify response (%s). %w", response.Response, err)
+	}
+	if !slices.Contains(request.Labels, answer.Label) {
+		return result, fmt.Errorf("classify response label (%s) is not one of the labels", answer.Label)
+	}
+
+	result.Label = answer.Label
+	return result, nil
+}
+
+// BackendConfig selects and configures a backend.  Kind is ollama, openai, pool, replay or fake.
+type BackendConfig struct {
+	Kind    string        `yaml:"kind"`
+	URL     string        `yaml:"url"`
+	APIKey  string        `yaml:"apiKey"`
+	Timeout time.Duration `yaml:"timeout"`
+
+	// Replay lists legacy "word: response" files answering ReplayModel with the text prompt version ReplayPrompt.
+	Replay       []string `yaml:"replay"`
+	ReplayModel  string   `yaml:"replayModel"`
+	ReplayPrompt string   `yaml:"replayPrompt"`
+	// Cassette holds the replay backend's recorded interactions.
+	Cassette string `yaml:"cassette"`
+	Record   bool   `yaml:"record"`
+
+	// HTTPCassette wraps the ollama or openai http transport in a CassetteTransport, HTTPCassetteMode is record or replay.
+	HTTPCassette     string `yaml:"httpCassette"`
+	HTTPCassetteMode string `yaml:"httpCassetteMode"`
+
+	// Pool lists the ollama hosts for the pool backend.
+	Pool PoolConfig `yaml:"pool"`
+
+	Cache CacheConfig `yaml:"cache"`
+}
+
+func DefaultBackendConfig() BackendConfig {
+	return BackendConfig{
+		Kind:             "ollama",
+		URL:              defaultOllamaUrl,
+		Timeout:          60 * time.Second,
+		ReplayModel:      "llama3.2",
+		ReplayPrompt:     "obscure-v1",
+		HTTPCassetteMode: CassetteReplay,
+		Pool:             DefaultPoolConfig(),
+		Cache:            DefaultCacheConfig(),
+	}
+}
+
+// NewBackend creates the configured backend, behind the response cache when it is enabled.  Release it with CloseBackend.
+func NewBackend(config BackendConfig) (Backend, error) {
+	backend, err := newBackend(config)
+	if err != nil || !config.Cache.Enabled {
+		return backend, err
+	}
+
+	return NewCacheBackend(backend, config.Cache)
+}
+
+func newBackend(config BackendConfig) (Backend, error) {
+	switch config.Kind {
+	case "", "ollama", "openai":
+		return newHttpBackend(config)
+	case "pool":
+		return NewPoolBackend(config.Pool, config.Timeout)
+	case "replay":
+		return newReplayBackend(config)
+	case "fake":
+		return NewFakeBackend(nil), nil
+	default:
+		return nil, fmt.Errorf("unknown backend kind (%s)", config.Kind)
+	}
+}
+
+func newHttpBackend(config BackendConfig) (Backend, error) {
+	httpClient := newHttpClient(config.Timeout)
+
+	var cassette *CassetteTransport
+	if config.HTTPCassette != "" {
+		t, err := NewCassetteTransport(config.HTTPCassette, config.HTTPCassetteMode, httpClient.Transport)
+		if err != nil {
+			return nil, err
+		}
+		httpClient.Transport = t
+		cassette = t
+	}
+
+	var backend Backend
+	if config.Kind == "openai" {
+		backend = NewOpenAIBackend(config.URL, config.APIKey, httpClient)
+	} else {
+		llamaUrl, err := url.Parse(config.URL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse url (%s)", err)
+		}
+		backend = NewOllamaBackend(ollama.NewClient(llamaUrl, httpClient))
+	}
+
+	if cassette != nil {
+		return &closingBackend{Backend: backend, close: cassette.Close}, nil
+	}
+	return backend, nil
+}
+
+func newReplayBackend(config BackendConfig) (Backend, error) {
+	replay := NewReplayBackend()
+	for _, path := range config.Replay {
+		if err := replay.LoadLegacyResponses(path, config.ReplayModel, config.ReplayPrompt); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.Cassette != "" {
+		if err := replay.LoadCassette(config.Cassette); err != nil {
+			return nil, err
+		}
+
+		if config.Record {
+			recorder, err := newHttpBackend(BackendConfig{Kind: "ollama", URL: config.URL, Timeout: config.Timeout})
+			if err != nil {
+				return nil, err
+			}
+			if err := replay.RecordTo(recorder, config.Cassette); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return replay, nil
+}
+
+// closingBackend releases resources held alongside a backend.
+type closingBackend struct {
+	Backend
+	close func()
+}
+
+func (b *closingBackend) Close() {
+	b.close()
+}
+
+// CloseBackend releases the resources held by backends that have any.
+func CloseBackend(backend Backend) {
+	if closer, ok := backend.(interface{ Close() }); ok {
+		closer.Close()
+	}
+}
+
+func getLogger() *zap.SugaredLogger {
+	return log.Get().Sugar().Named("llama")
+}
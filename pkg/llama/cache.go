@@ -0,0 +1,357 @@
+package llama
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CacheConfig enables the on-disk response cache.
+type CacheConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	Dir      string `yaml:"dir"`
+	MaxBytes int64  `yaml:"maxBytes"`
+}
+
+func DefaultCacheConfig() CacheConfig {
+	return CacheConfig{Enabled: false, Dir: "data/cache", MaxBytes: 256 * 1024 * 1024}
+}
+
+// ModelDescriber is implemented by backends that can identify the exact model behind a name, so a cache can tell when a
+// model has been replaced.
+type ModelDescriber interface {
+	ModelDigest(ctx context.Context, model string) (string, error)
+}
+
+// CacheEntry is a cached response, stored as json at <dir>/<key[:2]>/<key>.json.
+type CacheEntry struct {
+	Key         string                 `json:"key"`
+	Model       string                 `json:"model"`
+	ModelDigest string                 `json:"model_digest"`
+	Template    string                 `json:"template"`
+	Prompt      string                 `json:"prompt"`
+	Subject     string                 `json:"subject"`
+	Options     map[string]interface{} `json:"options"`
+	Response    string                 `json:"response"`
+	Metrics     Metrics                `json:"metrics"`
+	Stopped     bool                   `json:"stopped,omitempty"`
+	Created     time.Time              `json:"created"`
+}
+
+// digestRetry is how long a failure to describe a model is remembered, requests for it bypass the cache until then.
+const digestRetry = 30 * time.Second
+
+// CacheBackend is a content addressed cache in front of a backend's Generate.
+type CacheBackend struct {
+	Backend
+	config      CacheConfig
+	digests     sync.Map
+	digestRetry time.Duration
+	size        atomic.Int64
+	evict       sync.Mutex
+	hits        atomic.Int64
+	misses      atomic.Int64
+}
+
+func NewCacheBackend(backend Backend, config CacheConfig) (*CacheBackend, error) {
+	if err := os.MkdirAll(config.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache dir (%s). %w", config.Dir, err)
+	}
+
+	c := &CacheBackend{Backend: backend, config: config, digestRetry: digestRetry}
+	entries, size, err := scanCache(config.Dir)
+	if err != nil {
+		return nil, err
+	}
+	c.size.Store(size)
+
+	getLogger().Infof("response cache (%s), entries (%d), bytes (%d), max bytes (%d)", config.Dir, len(entries), size, config.MaxBytes)
+	return c, nil
+}
+
+func (c *CacheBackend) Name() string {
+	return c.Backend.Name() + "+cache"
+}
+
+func (c *CacheBackend) Generate(ctx context.Context, request GenerateRequest) (GenerateResponse, error) {
+	return c.cached(ctx, request, func() (GenerateResponse, error) {
+		return c.Backend.Generate(ctx, request)
+	})
+}
+
+// Chat is cached under the chat flattened into a generate request.
+func (c *CacheBackend) Chat(ctx context.Context, request ChatRequest) (ChatResponse, error) {
+	response, err := c.cached(ctx, chatAsGenerate(request), func() (GenerateResponse, error) {
+		response, err := c.Backend.Chat(ctx, request)
+		return GenerateResponse{Model: response.Model, Response: response.Message.Content, Metrics: response.Metrics}, err
+	})
+	return ChatResponse{Model: response.Model, Message: ChatMessage{Role: "assistant", Content: response.Response}, Metrics: response.Metrics}, err
+}
+
+// cached answers the request from the cache, or with generate on a miss, storing the answer.
+func (c *CacheBackend) cached(ctx context.Context, request GenerateRequest, generate func() (GenerateResponse, error)) (GenerateResponse, error) {
+	digest, found := c.modelDigest(ctx, request.Model)
+	if !found {
+		return generate()
+	}
+	key, err := cacheKey(digest, request)
+	if err != nil {
+		return generate()
+	}
+
+	path := c.entryPath(key)
+	if b, err := os.ReadFile(path); err == nil {
+		var entry CacheEntry
+		if err := json.Unmarshal(b, &entry); err == nil && entry.Key == key {
+			c.hits.Add(1)
+			now := time.Now()
+			if err := os.Chtimes(path, now, now); err != nil && !errors.Is(err, os.ErrNotExist) {
+				getLogger().Debugf("failed to touch cache entry (%s).  (%s)", path, err)
+			}
+			return GenerateResponse{Model: entry.Model, Response: entry.Response, Metrics: entry.Metrics, Stopped: entry.Stopped}, nil
+		}
+	}
+	c.misses.Add(1)
+
+	response, err := generate()
+	if err != nil {
+		return response, err
+	}
+
+	entry := CacheEntry{
+		Key:         key,
+		Model:       request.Model,
+		ModelDigest: digest,
+		Template:    request.Template,
+		Prompt:      request.Prompt,
+		Subject:     request.Subject,
+		Options:     request.Options,
+		Response:    response.Response,
+		Metrics:     response.Metrics,
+		Stopped:     response.Stopped,
+		Created:     time.Now(),
+	}
+	if err := c.store(path, entry); err != nil {
+		getLogger().Warnf("failed to cache response for subject (%s).  (%s)", request.Subject, err)
+	}
+
+	return response, nil
+}
+
+func (c *CacheBackend) Classify(ctx context.Context, request ClassifyRequest) (ClassifyResponse, error) {
+	return classifyWithGenerate(ctx, c, request)
+}
+
+func (c *CacheBackend) Close() {
+	getLogger().Infof("response cache, hits (%d), misses (%d), bytes (%d)", c.hits.Load(), c.misses.Load(), c.size.Load())
+	CloseBackend(c.Backend)
+}
+
+// Stats returns the cache hits and misses so far.
+func (c *CacheBackend) Stats() (int64, int64) {
+	return c.hits.Load(), c.misses.Load()
+}
+
+// ModelDigest passes the wrapped backend's digest through, for backends that have one.
+func (c *CacheBackend) ModelDigest(ctx context.Context, model string) (string, error) {
+	describer, ok := c.Backend.(ModelDescriber)
+	if !ok {
+		return "", fmt.Errorf("backend (%s) doesn't describe models", c.Backend.Name())
+	}
+	return describer.ModelDigest(ctx, model)
+}
+
+// modelDigest asks the backend for the model digest once per model, or uses the model name for backends that can't
+// describe models.  A failure is only remembered for digestRetry, and found is false until the model is described.
+func (c *CacheBackend) modelDigest(ctx context.Context, model string) (string, bool) {
+	if value, found := c.digests.Load(model); found {
+		if digest, ok := value.(string); ok {
+			return digest, true
+		}
+		if time.Since(value.(time.Time)) < c.digestRetry {
+			return "", false
+		}
+	}
+
+	describer, ok := c.Backend.(ModelDescriber)
+	if !ok {
+		c.digests.Store(model, model)
+		return model, true
+	}
+
+	digest, err := describer.ModelDigest(ctx, model)
+	if err != nil {
+		getLogger().Warnf("failed to get digest for model (%s), not caching its responses for (%s).  (%s)", model, c.digestRetry, err)
+		c.digests.Store(model, time.Now())
+		return "", false
+	}
+	c.digests.Store(model, digest)
+	return digest, true
+}
+
+func (c *CacheBackend) entryPath(key string) string {
+	return filepath.Join(c.config.Dir, key[:2], key+".json")
+}
+
+func (c *CacheBackend) store(path string, entry CacheEntry) error {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	// an overwritten entry only grows the cache by the difference in size
+	var replaced int64
+	if info, err := os.Stat(path); err == nil {
+		replaced = info.Size()
+	}
+
+	// write then rename, so a concurrent reader never sees a partial entry
+	tmp := fmt.Sprintf("%s.%d.tmp", path, time.Now().UnixNano())
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	if c.size.Add(int64(len(b))-replaced) > c.config.MaxBytes && c.config.MaxBytes > 0 {
+		c.evictOldest()
+	}
+	return nil
+}
+
+// evictOldest removes the least recently used entries until the cache is back under 90% of its maximum size.
+func (c *CacheBackend) evictOldest() {
+	if !c.evict.TryLock() {
+		return
+	}
+	defer c.evict.Unlock()
+
+	entries, size, err := scanCache(c.config.Dir)
+	if err != nil {
+		getLogger().Warnf("failed to scan cache for eviction.  (%s)", err)
+		return
+	}
+
+	target := c.config.MaxBytes * 9 / 10
+	removed := 0
+	for _, entry := range entries {
+		if size <= target {
+			break
+		}
+		if err := os.Remove(entry.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		size -= entry.size
+		removed++
+	}
+
+	c.size.Store(size)
+	getLogger().Debugf("response cache evicted entries (%d), bytes (%d)", removed, size)
+}
+
+type cacheFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// scanCache lists the cache entries least recently used first, with their total size.
+func scanCache(dir string) ([]cacheFile, int64, error) {
+	files := make([]cacheFile, 0)
+	total := int64(0)
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != ".json" {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		files = append(files, cacheFile{path: path, size: info.Size(), modTime: info.ModTime()})
+		total += info.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to scan cache dir (%s). %w", dir, err)
+	}
+
+	slices.SortFunc(files, func(a, b cacheFile) int { return a.modTime.Compare(b.modTime) })
+	return files, total, nil
+}
+
+func cacheKey(digest string, request GenerateRequest) (string, error) {
+	options, err := json.Marshal(request.Options)
+	if err != nil {
+		return "", err
+	}
+
+	parts := []string{digest, request.Template, request.System, request.Prompt, string(request.Format), string(options)}
+	if request.Until != nil {
+		// an early ended response is a different answer to the same prompt
+		parts = append(parts, "until")
+	}
+
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ClearCache removes cache entries, all of them when model is empty, otherwise only the entries for that model.
+func ClearCache(dir string, model string) (int, error) {
+	files, _, err := scanCache(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, file := range files {
+		if model != "" {
+			b, err := os.ReadFile(file.path)
+			if err != nil {
+				continue
+			}
+			var entry CacheEntry
+			if err := json.Unmarshal(b, &entry); err != nil || entry.Model != model {
+				continue
+			}
+		}
+
+		if err := os.Remove(file.path); err != nil {
+			return removed, fmt.Errorf("failed to remove cache entry (%s). %w", file.path, err)
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// CacheStats returns the number of entries and total bytes in the cache directory.
+func CacheStats(dir string) (int, int64, error) {
+	files, size, err := scanCache(dir)
+	return len(files), size, err
+}
@@ -0,0 +1,127 @@
+package llama
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// describedBackend is a fake backend describing its models with digest, or failing when digest is empty, counting the
+// attempts.
+type describedBackend struct {
+	*FakeBackend
+	digest    string
+	described atomic.Int64
+}
+
+func (b *describedBackend) ModelDigest(ctx context.Context, model string) (string, error) {
+	b.described.Add(1)
+	if b.digest == "" {
+		return "", errors.New("model not found")
+	}
+	return b.digest, nil
+}
+
+func TestCacheHit(t *testing.T) {
+	requests := 0
+	backend := &describedBackend{FakeBackend: NewFakeBackend(func(request GenerateRequest) string {
+		requests++
+		return "False. A familiar word."
+	}), digest: "sha256:a80c4f17acd5"}
+	cache, err := NewCacheBackend(backend, CacheConfig{Enabled: true, Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := GenerateRequest{Model: "llama3.2", Prompt: testPrompt, Subject: "abbey", Until: func(response string) bool { return true }}
+	miss, err := cache.Generate(context.Background(), request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// age the entry, a hit makes it the most recently used again
+	key, _ := cacheKey("sha256:a80c4f17acd5", request)
+	path := cache.entryPath(key)
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	hit, err := cache.Generate(context.Background(), request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requests != 1 {
+		t.Errorf("backend asked (%d) times, expected once", requests)
+	}
+	if hit.Response != miss.Response || hit.Metrics != miss.Metrics || hit.Stopped != miss.Stopped || !hit.Stopped {
+		t.Errorf("hit returned (%+v), expected (%+v)", hit, miss)
+	}
+	if info, err := os.Stat(path); err != nil || !info.ModTime().After(old) {
+		t.Errorf("hit didn't touch the entry (%v)", err)
+	}
+	if described := backend.described.Load(); described != 1 {
+		t.Errorf("model described (%d) times, expected once", described)
+	}
+}
+
+func TestCacheDigestFailure(t *testing.T) {
+	requests := 0
+	backend := &describedBackend{FakeBackend: NewFakeBackend(func(request GenerateRequest) string {
+		requests++
+		return "False. A familiar word."
+	})}
+	dir := t.TempDir()
+	cache, err := NewCacheBackend(backend, CacheConfig{Enabled: true, Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// without a digest nothing is cached, and the failure is remembered for a while
+	request := GenerateRequest{Model: "llama3.2", Prompt: testPrompt, Subject: "abbey"}
+	for range 2 {
+		if _, err := cache.Generate(context.Background(), request); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if entries, size, err := scanCache(dir); err != nil || len(entries) != 0 || requests != 2 {
+		t.Errorf("cache has entries (%d), bytes (%d), backend asked (%d) times, expected nothing cached", len(entries), size, requests)
+	}
+	if described := backend.described.Load(); described != 1 {
+		t.Errorf("model described (%d) times, expected the failure to be remembered", described)
+	}
+
+	// once the failure has expired the model is described again
+	cache.digestRetry = 0
+	backend.digest = "sha256:a80c4f17acd5"
+	for range 2 {
+		if _, err := cache.Generate(context.Background(), request); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if described := backend.described.Load(); described != 2 || requests != 3 {
+		t.Errorf("model described (%d) times, backend asked (%d) times after the failure expired", described, requests)
+	}
+}
+
+func TestCacheOverwriteSize(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := NewCacheBackend(NewFakeBackend(nil), CacheConfig{Enabled: true, Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// rewriting an entry, as concurrent misses of the same request do, only counts it once
+	path := cache.entryPath("a80c4f17acd5")
+	for _, response := range []string{"False. A familiar word.", "True.", "False. A familiar word."} {
+		if err := cache.store(path, CacheEntry{Response: response}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, size, err := scanCache(dir); err != nil || cache.size.Load() != size {
+		t.Errorf("cache counted bytes (%d), has (%d) on disk (%v)", cache.size.Load(), size, err)
+	}
+}
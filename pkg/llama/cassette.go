@@ -0,0 +1,197 @@
+package llama
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	CassetteRecord = "record"
+	CassetteReplay = "replay"
+)
+
+// HTTPInteraction is a recorded http exchange, one json object per line in a cassette file.
+type HTTPInteraction struct {
+	Key          string    `json:"key"`
+	Method       string    `json:"method"`
+	Path         string    `json:"path"`
+	RequestBody  string    `json:"request_body"`
+	StatusCode   int       `json:"status_code"`
+	ResponseBody string    `json:"response_body"`
+	RecordedAt   time.Time `json:"recorded_at"`
+}
+
+// CassetteTransport records http exchanges to a cassette, or replays them from it.
+type CassetteTransport struct {
+	mode  string
+	next  http.RoundTripper
+	mutex sync.Mutex
+	file  *os.File
+	tape  map[string]HTTPInteraction
+}
+
+// NewCassetteTransport loads the cassette at path.  next is only used in record mode.
+func NewCassetteTransport(path string, mode string, next http.RoundTripper) (*CassetteTransport, error) {
+	if mode != CassetteRecord && mode != CassetteReplay {
+		return nil, fmt.Errorf("unknown cassette mode (%s)", mode)
+	}
+
+	t := &CassetteTransport{mode: mode, next: next, tape: make(map[string]HTTPInteraction)}
+	if err := t.load(path); err != nil {
+		return nil, err
+	}
+
+	if mode == CassetteRecord {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open cassette (%s) for recording. %w", path, err)
+		}
+		t.file = f
+	}
+
+	getLogger().Infof("cassette transport, mode (%s), path (%s), recorded interactions (%d)", mode, path, len(t.tape))
+	return t, nil
+}
+
+func (t *CassetteTransport) load(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("failed to open cassette (%s). %w", path, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var interaction HTTPInteraction
+		if err := json.Unmarshal(scanner.Bytes(), &interaction); err != nil {
+			getLogger().Warnf("skipping invalid cassette line in (%s).  (%s)", path, err)
+			continue
+		}
+		t.tape[interaction.Key] = interaction
+	}
+	return scanner.Err()
+}
+
+func (t *CassetteTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	body := []byte{}
+	if request.Body != nil {
+		b, err := io.ReadAll(request.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body. %w", err)
+		}
+		request.Body.Close()
+		body = b
+		request.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	key := interactionHash(request.Method, request.URL.Path, body)
+
+	t.mutex.Lock()
+	interaction, found := t.tape[key]
+	t.mutex.Unlock()
+	if found {
+		return replayResponse(request, interaction), nil
+	}
+
+	if t.mode == CassetteReplay {
+		return nil, fmt.Errorf("%s %s. %w", request.Method, request.URL.Path, ErrNotRecorded)
+	}
+
+	response, err := t.next.RoundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	responseBody, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body. %w", err)
+	}
+
+	interaction = HTTPInteraction{
+		Key:          key,
+		Method:       request.Method,
+		Path:         request.URL.Path,
+		RequestBody:  string(body),
+		StatusCode:   response.StatusCode,
+		ResponseBody: string(responseBody),
+		RecordedAt:   time.Now(),
+	}
+	// errors are not recorded, a replay should see the server's real answer once it is back
+	if response.StatusCode < http.StatusInternalServerError {
+		if err := t.record(interaction); err != nil {
+			getLogger().Warnf("failed to record interaction (%s %s).  (%s)", request.Method, request.URL.Path, err)
+		}
+	}
+
+	return replayResponse(request, interaction), nil
+}
+
+func (t *CassetteTransport) record(interaction HTTPInteraction) error {
+	line, err := json.Marshal(interaction)
+	if err != nil {
+		return err
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.tape[interaction.Key] = interaction
+	_, err = t.file.Write(append(line, '\n'))
+	return err
+}
+
+func (t *CassetteTransport) Close() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.file != nil {
+		if err := t.file.Close(); err != nil {
+			getLogger().Warnf("failed to close cassette (%s).  (%s)", t.file.Name(), err)
+		}
+		t.file = nil
+	}
+}
+
+func replayResponse(request *http.Request, interaction HTTPInteraction) *http.Response {
+	return &http.Response{
+		Status:        http.StatusText(interaction.StatusCode),
+		StatusCode:    interaction.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader([]byte(interaction.ResponseBody))),
+		ContentLength: int64(len(interaction.ResponseBody)),
+		Request:       request,
+	}
+}
+
+// interactionHash keys a request.  Json bodies are re-marshaled so field order and whitespace don't matter.
+func interactionHash(method string, path string, body []byte) string {
+	canonical := body
+	var value any
+	if err := json.Unmarshal(body, &value); err == nil {
+		if b, err := json.Marshal(value); err == nil {
+			canonical = b
+		}
+	}
+
+	h := sha256.New()
+	h.Write([]byte(method + " " + path + "\n"))
+	h.Write(canonical)
+	return hex.EncodeToString(h.Sum(nil))
+}
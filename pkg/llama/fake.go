@@ -0,0 +1,151 @@
+package llama
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"time"
+)
+
+// FakeBackend is a deterministic in-process backend for exercising callers without a model.
+type FakeBackend struct {
+	respond func(request GenerateRequest) string
+}
+
+// NewFakeBackend uses respond to answer generate requests, or the hash based default when respond is nil.
+func NewFakeBackend(respond func(request GenerateRequest) string) *FakeBackend {
+	if respond == nil {
+		respond = fakeResponse
+	}
+	return &FakeBackend{respond: respond}
+}
+
+func (b *FakeBackend) Name() string {
+	return "fake"
+}
+
+func (b *FakeBackend) Generate(ctx context.Context, request GenerateRequest) (GenerateResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return GenerateResponse{}, err
+	}
+
+	start := time.Now()
+	response := b.respond(request)
+
+	// stream the answer a word at a time when it can end early
+	stopped := false
+	if request.Until != nil {
+		streamed := ""
+		for _, chunk := range strings.SplitAfter(response, " ") {
+			streamed += chunk
+			if request.Until(streamed) {
+				stopped = streamed != response
+				break
+			}
+		}
+		response = streamed
+	}
+
+	return GenerateResponse{
+		Model:    request.Model,
+		Response: response,
+		Metrics:  Metrics{TotalDuration: time.Since(start), PromptEvalCount: len(request.Prompt) / 4, EvalCount: len(response) / 4},
+		Stopped:  stopped,
+	}, nil
+}
+
+func (b *FakeBackend) Chat(ctx context.Context, request ChatRequest) (ChatResponse, error) {
+	return chatWithGenerate(ctx, b, request)
+}
+
+func (b *FakeBackend) Classify(ctx context.Context, request ClassifyRequest) (ClassifyResponse, error) {
+	return classifyWithGenerate(ctx, b, request)
+}
+
+func (b *FakeBackend) Embed(ctx context.Context, request EmbedRequest) (EmbedResponse, error) {
+	embeddings := make([][]float32, 0, len(request.Input))
+	for _, input := range request.Input {
+		h := fakeHash(request.Model, input)
+		embedding := make([]float32, 8)
+		for i := range embedding {
+			embedding[i] = float32((h>>(i*8))&0xff)/255 - 0.5
+		}
+		embeddings = append(embeddings, embedding)
+	}
+	return EmbedResponse{Model: request.Model, Embeddings: embeddings}, nil
+}
+
+func fakeResponse(request GenerateRequest) string {
+	h := fakeHash(request.Model, request.System, request.Prompt, fmt.Sprint(request.Options))
+
+	if len(request.Format) == 0 {
+		if h%2 == 0 {
+			return "True. This is a fake answer."
+		}
+		return "False. This is a fake answer."
+	}
+
+	var schema map[string]any
+	if err := json.Unmarshal(request.Format, &schema); err != nil {
+		return "{}"
+	}
+
+	b, err := json.Marshal(fakeValue(schema, h))
+	if err != nil {
+		return "{}"
+	}
+	return string(b)
+}
+
+// fakeValue builds a value satisfying the (simple) json schema, picking booleans, numbers and enum values from h.
+func fakeValue(schema map[string]any, h uint64) any {
+	if enum, ok := schema["enum"].([]any); ok && len(enum) > 0 {
+		return enum[h%uint64(len(enum))]
+	}
+
+	switch schema["type"] {
+	case "object":
+		value := make(map[string]any)
+		properties, _ := schema["properties"].(map[string]any)
+		for name, property := range properties {
+			propertySchema, _ := property.(map[string]any)
+			value[name] = fakeValue(propertySchema, fakeHash(fmt.Sprint(h), name))
+		}
+		return value
+	case "array":
+		// minItems items, any enum inside them is picked per item so it can repeat
+		minItems, _ := schema["minItems"].(float64)
+		items, _ := schema["items"].(map[string]any)
+		value := make([]any, 0, int(minItems))
+		for i := 0; i < int(minItems); i++ {
+			value = append(value, fakeValue(items, fakeHash(fmt.Sprint(h), fmt.Sprint(i))))
+		}
+		return value
+	case "boolean":
+		return h%2 == 0
+	case "number":
+		minimum, _ := schema["minimum"].(float64)
+		maximum, hasMaximum := schema["maximum"].(float64)
+		if !hasMaximum {
+			maximum = minimum + 1
+		}
+		return minimum + (maximum-minimum)*float64(h%101)/100
+	case "integer":
+		return h % 100
+	case "string":
+		return "fake"
+	default:
+		return nil
+	}
+}
+
+func fakeHash(parts ...string) uint64 {
+	h := fnv.New64a()
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return h.Sum64()
+}
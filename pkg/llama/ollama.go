@@ -0,0 +1,156 @@
+package llama
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	ollama "github.com/ollama/ollama/api"
+	"time"
+)
+
+// errStopped ends a streamed generate once the request's Until is satisfied.
+var errStopped = errors.New("generate stopped early")
+
+// OllamaBackend uses the native ollama api.
+type OllamaBackend struct {
+	client *ollama.Client
+}
+
+func NewOllamaBackend(client *ollama.Client) *OllamaBackend {
+	return &OllamaBackend{client: client}
+}
+
+func (b *OllamaBackend) Name() string {
+	return "ollama"
+}
+
+func (b *OllamaBackend) Client() *ollama.Client {
+	return b.client
+}
+
+func (b *OllamaBackend) Generate(ctx context.Context, request GenerateRequest) (GenerateResponse, error) {
+	generateRequest := &ollama.GenerateRequest{
+		Model:   request.Model,
+		System:  request.System,
+		Prompt:  request.Prompt,
+		Format:  request.Format,
+		Options: request.Options,
+
+		// set streaming to false
+		Stream: new(bool),
+	}
+
+	// stream when the response can end early
+	if request.Until != nil {
+		stream := true
+		generateRequest.Stream = &stream
+	}
+
+	start := time.Now()
+	chunks := 0
+	response := GenerateResponse{Model: request.Model}
+	respFunc := func(resp ollama.GenerateResponse) error {
+		chunks++
+		response.Response += resp.Response
+		if resp.Model != "" {
+			response.Model = resp.Model
+		}
+		if resp.Done {
+			response.Metrics = fromOllamaMetrics(resp.Metrics)
+			return nil
+		}
+		if request.Until != nil && request.Until(response.Response) {
+			return errStopped
+		}
+		return nil
+	}
+
+	if err := b.client.Generate(ctx, generateRequest, respFunc); err != nil {
+		if errors.Is(err, errStopped) {
+			// the final metrics never arrive, each streamed chunk is a token
+			response.Stopped = true
+			response.Metrics = Metrics{TotalDuration: time.Since(start), EvalCount: chunks}
+			return response, nil
+		}
+		return response, fromOllamaError(err)
+	}
+	return response, nil
+}
+
+func (b *OllamaBackend) Chat(ctx context.Context, request ChatRequest) (ChatResponse, error) {
+	chatRequest := &ollama.ChatRequest{
+		Model:   request.Model,
+		Format:  request.Format,
+		Options: request.Options,
+
+		// set streaming to false
+		Stream: new(bool),
+	}
+	for _, message := range request.Messages {
+		chatRequest.Messages = append(chatRequest.Messages, ollama.Message{Role: message.Role, Content: message.Content})
+	}
+
+	response := ChatResponse{Model: request.Model, Message: ChatMessage{Role: "assistant"}}
+	respFunc := func(resp ollama.ChatResponse) error {
+		response.Message.Content += resp.Message.Content
+		if resp.Model != "" {
+			response.Model = resp.Model
+		}
+		if resp.Done {
+			response.Metrics = fromOllamaMetrics(resp.Metrics)
+		}
+		return nil
+	}
+
+	if err := b.client.Chat(ctx, chatRequest, respFunc); err != nil {
+		return response, fromOllamaError(err)
+	}
+	return response, nil
+}
+
+func (b *OllamaBackend) Classify(ctx context.Context, request ClassifyRequest) (ClassifyResponse, error) {
+	return classifyWithGenerate(ctx, b, request)
+}
+
+func (b *OllamaBackend) Embed(ctx context.Context, request EmbedRequest) (EmbedResponse, error) {
+	resp, err := b.client.Embed(ctx, &ollama.EmbedRequest{Model: request.Model, Input: request.Input})
+	if err != nil {
+		return EmbedResponse{}, fromOllamaError(err)
+	}
+
+	return EmbedResponse{Model: resp.Model, Embeddings: resp.Embeddings}, nil
+}
+
+// ModelDigest identifies the model by a hash of its Show details, which leave out the digest.
+func (b *OllamaBackend) ModelDigest(ctx context.Context, model string) (string, error) {
+	show, err := b.client.Show(ctx, &ollama.ShowRequest{Model: model})
+	if err != nil {
+		return "", fromOllamaError(err)
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00%+v\x00%s", show.Modelfile, show.Parameters, show.Template, show.Details, show.ModifiedAt)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func fromOllamaMetrics(m ollama.Metrics) Metrics {
+	return Metrics{
+		TotalDuration:      m.TotalDuration,
+		LoadDuration:       m.LoadDuration,
+		PromptEvalCount:    m.PromptEvalCount,
+		PromptEvalDuration: m.PromptEvalDuration,
+		EvalCount:          m.EvalCount,
+		EvalDuration:       m.EvalDuration,
+	}
+}
+
+// fromOllamaError converts ollama status errors so callers only need to know about StatusError.
+func fromOllamaError(err error) error {
+	var statusErr ollama.StatusError
+	if errors.As(err, &statusErr) {
+		return StatusError{StatusCode: statusErr.StatusCode, Message: statusErr.Error()}
+	}
+	return err
+}
@@ -0,0 +1,283 @@
+package llama
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// OpenAIBackend talks to any server implementing the openai /v1/chat/completions and /v1/embeddings endpoints, such
+// as the llama.cpp server, vLLM or LM Studio.
+type OpenAIBackend struct {
+	baseUrl    string
+	apiKey     string
+	httpClient *http.Client
+}
+
+func NewOpenAIBackend(baseUrl string, apiKey string, httpClient *http.Client) *OpenAIBackend {
+	return &OpenAIBackend{baseUrl: strings.TrimSuffix(baseUrl, "/"), apiKey: apiKey, httpClient: httpClient}
+}
+
+func (b *OpenAIBackend) Name() string {
+	return "openai"
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatCompletionRequest struct {
+	Model          string         `json:"model"`
+	Messages       []chatMessage  `json:"messages"`
+	Temperature    *float64       `json:"temperature,omitempty"`
+	TopP           *float64       `json:"top_p,omitempty"`
+	Seed           *int           `json:"seed,omitempty"`
+	MaxTokens      *int           `json:"max_tokens,omitempty"`
+	ResponseFormat map[string]any `json:"response_format,omitempty"`
+	Stream         bool           `json:"stream,omitempty"`
+	StreamOptions  map[string]any `json:"stream_options,omitempty"`
+}
+
+type completionUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+type chatCompletionResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message chatMessage `json:"message"`
+	} `json:"choices"`
+	Usage completionUsage `json:"usage"`
+}
+
+// chatCompletionChunk is one server sent event of a streamed chat completion.  The usage only comes with the last one.
+type chatCompletionChunk struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Delta        chatMessage `json:"delta"`
+		FinishReason *string     `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *completionUsage `json:"usage"`
+}
+
+func (b *OpenAIBackend) Generate(ctx context.Context, request GenerateRequest) (GenerateResponse, error) {
+	chat := ChatRequest{Model: request.Model, Format: request.Format, Options: request.Options}
+	if request.System != "" {
+		chat.Messages = append(chat.Messages, ChatMessage{Role: "system", Content: request.System})
+	}
+	chat.Messages = append(chat.Messages, ChatMessage{Role: "user", Content: request.Prompt})
+
+	// stream when the response can end early
+	if request.Until != nil {
+		return b.streamChat(ctx, chatCompletion(chat), request.Until)
+	}
+
+	response, err := b.Chat(ctx, chat)
+	return GenerateResponse{Model: response.Model, Response: response.Message.Content, Metrics: response.Metrics}, err
+}
+
+func (b *OpenAIBackend) Chat(ctx context.Context, request ChatRequest) (ChatResponse, error) {
+	start := time.Now()
+	var response chatCompletionResponse
+	if err := b.post(ctx, "/v1/chat/completions", chatCompletion(request), &response); err != nil {
+		return ChatResponse{Model: request.Model}, err
+	}
+
+	if len(response.Choices) == 0 {
+		return ChatResponse{Model: response.Model}, fmt.Errorf("chat completion returned no choices")
+	}
+
+	message := response.Choices[0].Message
+	return ChatResponse{
+		Model:   response.Model,
+		Message: ChatMessage{Role: message.Role, Content: message.Content},
+		Metrics: Metrics{
+			TotalDuration:   time.Since(start),
+			PromptEvalCount: response.Usage.PromptTokens,
+			EvalCount:       response.Usage.CompletionTokens,
+		},
+	}, nil
+}
+
+// streamChat streams the completion until it is done or until is satisfied.
+func (b *OpenAIBackend) streamChat(ctx context.Context, completion chatCompletionRequest, until func(response string) bool) (GenerateResponse, error) {
+	completion.Stream = true
+	completion.StreamOptions = map[string]any{"include_usage": true}
+
+	start := time.Now()
+	resp, err := b.do(ctx, "/v1/chat/completions", completion)
+	if err != nil {
+		return GenerateResponse{Model: completion.Model}, err
+	}
+	defer resp.Body.Close()
+
+	chunks := 0
+	response := GenerateResponse{Model: completion.Model}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, found := strings.CutPrefix(scanner.Text(), "data:")
+		data = strings.TrimSpace(data)
+		if !found || data == "" {
+			continue
+		}
+		if data == "[DONE]" {
+			break
+		}
+
+		var chunk chatCompletionChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return response, fmt.Errorf("invalid stream chunk from (/v1/chat/completions). %w", err)
+		}
+		if chunk.Model != "" {
+			response.Model = chunk.Model
+		}
+		if chunk.Usage != nil {
+			response.Metrics.PromptEvalCount = chunk.Usage.PromptTokens
+			response.Metrics.EvalCount = chunk.Usage.CompletionTokens
+		}
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+
+		chunks++
+		response.Response += chunk.Choices[0].Delta.Content
+		if chunk.Choices[0].FinishReason == nil && until(response.Response) {
+			// the usage never arrives, each streamed chunk is a token
+			response.Stopped = true
+			response.Metrics = Metrics{TotalDuration: time.Since(start), EvalCount: chunks}
+			return response, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return response, err
+	}
+
+	response.Metrics.TotalDuration = time.Since(start)
+	return response, nil
+}
+
+// chatCompletion translates the chat request, and the options the openai api knows, into a chat completion request.
+func chatCompletion(request ChatRequest) chatCompletionRequest {
+	completion := chatCompletionRequest{Model: request.Model}
+	for _, message := range request.Messages {
+		completion.Messages = append(completion.Messages, chatMessage{Role: message.Role, Content: message.Content})
+	}
+
+	completion.Temperature = floatOption(request.Options, "temperature")
+	completion.TopP = floatOption(request.Options, "top_p")
+	completion.Seed = intOption(request.Options, "seed")
+	completion.MaxTokens = intOption(request.Options, "num_predict")
+
+	if len(request.Format) > 0 {
+		completion.ResponseFormat = map[string]any{
+			"type":        "json_schema",
+			"json_schema": map[string]any{"name": "response", "schema": request.Format, "strict": true},
+		}
+	}
+	return completion
+}
+
+func (b *OpenAIBackend) Classify(ctx context.Context, request ClassifyRequest) (ClassifyResponse, error) {
+	return classifyWithGenerate(ctx, b, request)
+}
+
+func (b *OpenAIBackend) Embed(ctx context.Context, request EmbedRequest) (EmbedResponse, error) {
+	var response struct {
+		Model string `json:"model"`
+		Data  []struct {
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+
+	body := map[string]any{"model": request.Model, "input": request.Input}
+	if err := b.post(ctx, "/v1/embeddings", body, &response); err != nil {
+		return EmbedResponse{}, err
+	}
+
+	embeddings := make([][]float32, 0, len(response.Data))
+	for _, data := range response.Data {
+		embeddings = append(embeddings, data.Embedding)
+	}
+	return EmbedResponse{Model: response.Model, Embeddings: embeddings}, nil
+}
+
+func (b *OpenAIBackend) post(ctx context.Context, path string, body any, response any) error {
+	resp, err := b.do(ctx, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(respBody, response); err != nil {
+		return fmt.Errorf("invalid response from (%s). %w", path, err)
+	}
+	return nil
+}
+
+// do posts body as json to path, the caller closes the body of a successful response.
+func (b *OpenAIBackend) do(ctx context.Context, path string, body any) (*http.Response, error) {
+	b2, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request for (%s). %w", path, err)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, b.baseUrl+path, bytes.NewReader(b2))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request for (%s). %w", path, err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if b.apiKey != "" {
+		request.Header.Set("Authorization", "Bearer "+b.apiKey)
+	}
+
+	resp, err := b.httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+		respBody, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		return nil, StatusError{StatusCode: resp.StatusCode, Message: string(respBody)}
+	}
+	return resp, nil
+}
+
+func floatOption(options map[string]interface{}, name string) *float64 {
+	switch v := options[name].(type) {
+	case float64:
+		return &v
+	case int:
+		f := float64(v)
+		return &f
+	}
+	return nil
+}
+
+func intOption(options map[string]interface{}, name string) *int {
+	switch v := options[name].(type) {
+	case int:
+		return &v
+	case float64:
+		i := int(v)
+		return &i
+	}
+	return nil
+}
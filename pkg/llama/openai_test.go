@@ -0,0 +1,60 @@
+package llama
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// openAIStandIn streams the chat completion answer a word per event, or answers it at once when not asked to stream.
+func openAIStandIn(t *testing.T, answer string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request chatCompletionRequest
+		if r.URL.Path != "/v1/chat/completions" || json.NewDecoder(r.Body).Decode(&request) != nil {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		if !request.Stream {
+			fmt.Fprintf(w, `{"model": "llama3.2", "choices": [{"message": {"role": "assistant", "content": %q}}], "usage": {"completion_tokens": 9}}`, answer)
+			return
+		}
+
+		words := strings.SplitAfter(answer, " ")
+		for i, word := range words {
+			finish := "null"
+			if i == len(words)-1 {
+				finish = `"stop"`
+			}
+			fmt.Fprintf(w, "data: {\"model\": \"llama3.2\", \"choices\": [{\"delta\": {\"content\": %q}, \"finish_reason\": %s}]}\n\n", word, finish)
+		}
+		fmt.Fprint(w, "data: {\"model\": \"llama3.2\", \"choices\": [], \"usage\": {\"prompt_tokens\": 12, \"completion_tokens\": 9}}\n\ndata: [DONE]\n\n")
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestOpenAIUntil(t *testing.T) {
+	const answer = "False. An abbey is a familiar word for a monastery."
+	backend := NewOpenAIBackend(openAIStandIn(t, answer).URL, "", http.DefaultClient)
+
+	for _, c := range []struct {
+		until    func(string) bool
+		expected string
+		stopped  bool
+		evals    int
+	}{
+		{nil, answer, false, 9},
+		{func(response string) bool { return strings.Contains(response, ".") }, "False. ", true, 1},
+		{func(response string) bool { return false }, answer, false, 9},
+	} {
+		response, err := backend.Generate(context.Background(), GenerateRequest{Model: "llama3.2", Prompt: testPrompt, Until: c.until})
+		if err != nil || response.Response != c.expected || response.Stopped != c.stopped || response.Metrics.EvalCount != c.evals {
+			t.Errorf("generate returned (%q, stopped %t, evals %d, %v), expected (%q, stopped %t, evals %d)",
+				response.Response, response.Stopped, response.Metrics.EvalCount, err, c.expected, c.stopped, c.evals)
+		}
+	}
+}
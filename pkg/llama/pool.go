@@ -0,0 +1,308 @@
+package llama
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	ollama "github.com/ollama/ollama/api"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// EndpointConfig is one ollama host in a pool.
+type EndpointConfig struct {
+	URL            string `yaml:"url"`
+	MaxConcurrency int    `yaml:"maxConcurrency"`
+}
+
+// PoolConfig spreads requests over several ollama hosts.
+type PoolConfig struct {
+	Endpoints      []EndpointConfig `yaml:"endpoints"`
+	HealthInterval time.Duration    `yaml:"healthInterval"`
+	EjectAfter     int              `yaml:"ejectAfter"`
+}
+
+func DefaultPoolConfig() PoolConfig {
+	return PoolConfig{HealthInterval: 10 * time.Second, EjectAfter: 3}
+}
+
+type endpoint struct {
+	url            string
+	maxConcurrency int
+	client         *ollama.Client
+	backend        *OllamaBackend
+
+	// guarded by the pool mutex
+	outstanding int
+	failures    int
+	healthy     bool
+
+	requests int64
+	errors   int64
+	latency  time.Duration
+	ejected  int64
+}
+
+// PoolBackend routes each request to the healthy ollama host with the fewest outstanding requests relative to its
+// concurrency limit, waiting when every host is at its limit.
+type PoolBackend struct {
+	config    PoolConfig
+	endpoints []*endpoint
+	start     time.Time
+	cancel    context.CancelFunc
+
+	mutex sync.Mutex
+	wake  chan struct{}
+}
+
+func NewPoolBackend(config PoolConfig, timeout time.Duration) (*PoolBackend, error) {
+	if len(config.Endpoints) == 0 {
+		return nil, fmt.Errorf("backend pool has no endpoints")
+	}
+
+	p := &PoolBackend{config: config, start: time.Now(), wake: make(chan struct{})}
+	for _, endpointConfig := range config.Endpoints {
+		client, err := CreateClientWithTransport(endpointConfig.URL, timeout, func(next http.RoundTripper) http.RoundTripper {
+			return serverErrorTransport{next: next}
+		})
+		if err != nil {
+			return nil, err
+		}
+		p.endpoints = append(p.endpoints, &endpoint{
+			url:            endpointConfig.URL,
+			maxConcurrency: max(endpointConfig.MaxConcurrency, 1),
+			client:         client,
+			backend:        NewOllamaBackend(client),
+			healthy:        true,
+		})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	go p.checkHealth(ctx)
+
+	getLogger().Infof("backend pool, endpoints (%d), health interval (%s), eject after failures (%d)", len(p.endpoints), config.HealthInterval, config.EjectAfter)
+	return p, nil
+}
+
+func (p *PoolBackend) Name() string {
+	return "pool"
+}
+
+// acquire waits for the least loaded healthy endpoint with capacity.
+func (p *PoolBackend) acquire(ctx context.Context) (*endpoint, error) {
+	for {
+		p.mutex.Lock()
+		var best *endpoint
+		healthy := 0
+		for _, e := range p.endpoints {
+			if !e.healthy {
+				continue
+			}
+			healthy++
+			if e.outstanding >= e.maxConcurrency {
+				continue
+			}
+			if best == nil || float64(e.outstanding)/float64(e.maxConcurrency) < float64(best.outstanding)/float64(best.maxConcurrency) {
+				best = e
+			}
+		}
+		if best != nil {
+			best.outstanding++
+			p.mutex.Unlock()
+			return best, nil
+		}
+		wake := p.wake
+		p.mutex.Unlock()
+
+		if healthy == 0 {
+			return nil, StatusError{StatusCode: http.StatusServiceUnavailable, Message: "no healthy endpoints in backend pool"}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-wake:
+		}
+	}
+}
+
+func (p *PoolBackend) release(ctx context.Context, e *endpoint, latency time.Duration, err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	e.outstanding--
+	e.requests++
+	e.latency += latency
+
+	if isEndpointFailure(ctx, err) {
+		e.errors++
+		e.failures++
+		if e.healthy && p.config.EjectAfter > 0 && e.failures >= p.config.EjectAfter {
+			p.eject(e, err)
+		}
+	} else if err == nil {
+		e.failures = 0
+	}
+
+	close(p.wake)
+	p.wake = make(chan struct{})
+}
+
+// serverErrorTransport turns 5xx responses into a StatusError, the ollama client reports them without the status.
+type serverErrorTransport struct {
+	next http.RoundTripper
+}
+
+func (t serverErrorTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	response, err := t.next.RoundTrip(request)
+	if err != nil || response.StatusCode < http.StatusInternalServerError {
+		return response, err
+	}
+
+	defer response.Body.Close()
+	message, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+	return nil, StatusError{StatusCode: response.StatusCode, Message: strings.TrimSpace(string(message))}
+}
+
+// isEndpointFailure returns true for connection failures and 5xx statuses, not for the caller's deadlines.
+func isEndpointFailure(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var statusErr StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= http.StatusInternalServerError
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return false
+	}
+	return opErr != nil || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// eject must be called with the mutex held.
+func (p *PoolBackend) eject(e *endpoint, err error) {
+	e.healthy = false
+	e.ejected++
+	getLogger().Warnf("ejecting pool endpoint (%s) after failures (%d).  (%s)", e.url, e.failures, err)
+}
+
+func (p *PoolBackend) checkHealth(ctx context.Context) {
+	interval := p.config.HealthInterval
+	if interval <= 0 {
+		interval = DefaultPoolConfig().HealthInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, e := range p.endpoints {
+				heartbeatCtx, cancel := context.WithTimeout(ctx, interval)
+				err := e.client.Heartbeat(heartbeatCtx)
+				cancel()
+
+				p.mutex.Lock()
+				switch {
+				case err != nil && e.healthy:
+					e.failures = max(e.failures, p.config.EjectAfter)
+					p.eject(e, err)
+				case err == nil && !e.healthy:
+					e.healthy = true
+					e.failures = 0
+					getLogger().Infof("readmitting pool endpoint (%s)", e.url)
+					close(p.wake)
+					p.wake = make(chan struct{})
+				}
+				p.mutex.Unlock()
+			}
+		}
+	}
+}
+
+func (p *PoolBackend) Generate(ctx context.Context, request GenerateRequest) (GenerateResponse, error) {
+	e, err := p.acquire(ctx)
+	if err != nil {
+		return GenerateResponse{Model: request.Model}, err
+	}
+
+	start := time.Now()
+	response, err := e.backend.Generate(ctx, request)
+	p.release(ctx, e, time.Since(start), err)
+	return response, err
+}
+
+func (p *PoolBackend) Chat(ctx context.Context, request ChatRequest) (ChatResponse, error) {
+	e, err := p.acquire(ctx)
+	if err != nil {
+		return ChatResponse{Model: request.Model}, err
+	}
+
+	start := time.Now()
+	response, err := e.backend.Chat(ctx, request)
+	p.release(ctx, e, time.Since(start), err)
+	return response, err
+}
+
+func (p *PoolBackend) Classify(ctx context.Context, request ClassifyRequest) (ClassifyResponse, error) {
+	return classifyWithGenerate(ctx, p, request)
+}
+
+func (p *PoolBackend) Embed(ctx context.Context, request EmbedRequest) (EmbedResponse, error) {
+	e, err := p.acquire(ctx)
+	if err != nil {
+		return EmbedResponse{}, err
+	}
+
+	start := time.Now()
+	response, err := e.backend.Embed(ctx, request)
+	p.release(ctx, e, time.Since(start), err)
+	return response, err
+}
+
+// ModelDigest asks a healthy endpoint.  Hosts are expected to serve the same model under the same name.
+func (p *PoolBackend) ModelDigest(ctx context.Context, model string) (string, error) {
+	e, err := p.acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	start := time.Now()
+	digest, err := e.backend.ModelDigest(ctx, model)
+	p.release(ctx, e, time.Since(start), err)
+	return digest, err
+}
+
+// Close stops the health checks and reports the per host throughput.
+func (p *PoolBackend) Close() {
+	p.cancel()
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	elapsed := time.Since(p.start)
+	for _, e := range p.endpoints {
+		average := 0.0
+		if e.requests > 0 {
+			average = float64(e.latency.Milliseconds()) / float64(e.requests)
+		}
+		getLogger().Infof("pool endpoint (%s), requests (%d), errors (%d), ejections (%d), requests per second (%f), average milliseconds (%f)",
+			e.url, e.requests, e.errors, e.ejected, float64(e.requests)/elapsed.Seconds(), average)
+	}
+}
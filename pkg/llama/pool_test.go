@@ -0,0 +1,215 @@
+package llama
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// poolHost is a stand-in ollama host that can be made to fail, or to hold generate requests until released.
+type poolHost struct {
+	server   *httptest.Server
+	failing  atomic.Bool
+	requests atomic.Int64
+	hold     chan struct{}
+	arrived  chan struct{}
+}
+
+func newPoolHost(t *testing.T) *poolHost {
+	h := &poolHost{arrived: make(chan struct{}, 16)}
+	h.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"error":"host is down"}`))
+			return
+		}
+		if r.URL.Path != "/api/generate" {
+			// heartbeat
+			return
+		}
+
+		h.requests.Add(1)
+		h.arrived <- struct{}{}
+		if h.hold != nil {
+			<-h.hold
+		}
+		w.Write([]byte(`{"model":"llama3.2","response":"False.","done":true}`))
+	}))
+	t.Cleanup(h.server.Close)
+	return h
+}
+
+func newTestPool(t *testing.T, config PoolConfig, hosts ...*poolHost) *PoolBackend {
+	t.Helper()
+	for _, h := range hosts {
+		config.Endpoints = append(config.Endpoints, EndpointConfig{URL: h.server.URL, MaxConcurrency: 1})
+	}
+	pool, err := NewPoolBackend(config, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+func poolGenerate(pool *PoolBackend) error {
+	_, err := pool.Generate(context.Background(), GenerateRequest{Model: "llama3.2", Prompt: "is \"abbey\" obscure?", Subject: "abbey"})
+	return err
+}
+
+// waitHealthy waits for the heartbeat to set the health of the endpoint at index.
+func waitHealthy(t *testing.T, pool *PoolBackend, index int, healthy bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		pool.mutex.Lock()
+		actual := pool.endpoints[index].healthy
+		pool.mutex.Unlock()
+		if actual == healthy {
+			return
+		}
+	}
+	t.Fatalf("endpoint (%d) didn't become healthy (%t)", index, healthy)
+}
+
+func TestPoolLeastOutstanding(t *testing.T) {
+	busy, idle := newPoolHost(t), newPoolHost(t)
+	busy.hold = make(chan struct{})
+	config := DefaultPoolConfig()
+	config.HealthInterval = time.Hour
+	pool := newTestPool(t, config, busy, idle)
+	pool.endpoints[0].maxConcurrency = 4
+
+	// the first request goes to the first host and stays outstanding there
+	done := make(chan error)
+	go func() { done <- poolGenerate(pool) }()
+	<-busy.arrived
+
+	// one outstanding of four still loads the busy host more than the idle one
+	for range 3 {
+		if err := poolGenerate(pool); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(busy.hold)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if busy.requests.Load() != 1 || idle.requests.Load() != 3 {
+		t.Errorf("busy host served (%d), idle host served (%d), expected 1 and 3", busy.requests.Load(), idle.requests.Load())
+	}
+}
+
+func TestPoolEjectAfterFailures(t *testing.T) {
+	good, bad := newPoolHost(t), newPoolHost(t)
+	bad.failing.Store(true)
+	config := DefaultPoolConfig()
+	config.HealthInterval = time.Hour
+	config.EjectAfter = 2
+	pool := newTestPool(t, config, bad, good)
+
+	// the failing host is first in line until its second failure ejects it
+	failures := 0
+	for range 6 {
+		if poolGenerate(pool) != nil {
+			failures++
+		}
+	}
+	if failures != 2 {
+		t.Errorf("requests failed (%d), expected the two before the ejection", failures)
+	}
+	waitHealthy(t, pool, 0, false)
+	if good.requests.Load() != 4 {
+		t.Errorf("healthy host served (%d), expected 4", good.requests.Load())
+	}
+}
+
+func TestPoolSlowHostNotEjected(t *testing.T) {
+	slow := newPoolHost(t)
+	slow.hold = make(chan struct{})
+	defer close(slow.hold)
+	config := DefaultPoolConfig()
+	config.HealthInterval = time.Hour
+	config.EjectAfter = 1
+	pool := newTestPool(t, config, slow)
+
+	// answers slower than the word deadline say nothing about the host
+	for range 3 {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		_, err := pool.Generate(ctx, GenerateRequest{Model: "llama3.2", Prompt: "is \"abbey\" obscure?", Subject: "abbey"})
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("slow host returned (%v), expected the deadline", err)
+		}
+	}
+	pool.mutex.Lock()
+	healthy := pool.endpoints[0].healthy
+	pool.mutex.Unlock()
+	if !healthy {
+		t.Errorf("slow host was ejected")
+	}
+}
+
+func TestPoolUnreachableHostEjected(t *testing.T) {
+	good, gone := newPoolHost(t), newPoolHost(t)
+	gone.server.Close()
+	config := DefaultPoolConfig()
+	config.HealthInterval = time.Hour
+	config.EjectAfter = 1
+	pool := newTestPool(t, config, gone, good)
+
+	if err := poolGenerate(pool); err == nil {
+		t.Errorf("unreachable host answered")
+	}
+	waitHealthy(t, pool, 0, false)
+	if err := poolGenerate(pool); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPoolHeartbeatEjectAndReadmit(t *testing.T) {
+	good, flaky := newPoolHost(t), newPoolHost(t)
+	config := DefaultPoolConfig()
+	config.HealthInterval = 10 * time.Millisecond
+	pool := newTestPool(t, config, flaky, good)
+
+	flaky.failing.Store(true)
+	waitHealthy(t, pool, 0, false)
+	for range 3 {
+		if err := poolGenerate(pool); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if flaky.requests.Load() != 0 || good.requests.Load() != 3 {
+		t.Errorf("ejected host served (%d), healthy host served (%d), expected 0 and 3", flaky.requests.Load(), good.requests.Load())
+	}
+
+	flaky.failing.Store(false)
+	waitHealthy(t, pool, 0, true)
+	if err := poolGenerate(pool); err != nil {
+		t.Fatal(err)
+	}
+	if flaky.requests.Load() != 1 {
+		t.Errorf("readmitted host served (%d), expected 1", flaky.requests.Load())
+	}
+}
+
+func TestPoolAllHostsDown(t *testing.T) {
+	first, second := newPoolHost(t), newPoolHost(t)
+	first.failing.Store(true)
+	second.failing.Store(true)
+	config := DefaultPoolConfig()
+	config.HealthInterval = 10 * time.Millisecond
+	pool := newTestPool(t, config, first, second)
+	waitHealthy(t, pool, 0, false)
+	waitHealthy(t, pool, 1, false)
+
+	var statusErr StatusError
+	if err := poolGenerate(pool); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("pool with every host down returned (%v), expected service unavailable", err)
+	}
+}
@@ -0,0 +1,268 @@
+package llama
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotRecorded is returned by the replay backend for a request with no recorded response.
+var ErrNotRecorded = errors.New("no recorded response")
+
+// Interaction is a recorded generate request and its response, one json object per line in a cassette file.
+type Interaction struct {
+	Model      string    `json:"model"`
+	Prompt     string    `json:"prompt"`
+	Subject    string    `json:"subject"`
+	Response   string    `json:"response"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+type interactionKey struct {
+	model   string
+	prompt  string
+	subject string
+}
+
+type legacyKey struct {
+	model    string
+	template string
+	subject  string
+}
+
+// ReplayBackend serves recorded responses keyed by model, prompt and subject.
+type ReplayBackend struct {
+	mutex       sync.RWMutex
+	recorded    map[interactionKey]string
+	legacy      map[legacyKey]string
+	recorder    Backend
+	cassette    *os.File
+	hits        int64
+	misses      int64
+	recordCount int64
+}
+
+func NewReplayBackend() *ReplayBackend {
+	return &ReplayBackend{recorded: make(map[interactionKey]string), legacy: make(map[legacyKey]string)}
+}
+
+func (b *ReplayBackend) Name() string {
+	return "replay"
+}
+
+// legacyEntryPattern matches the first line of an entry in a legacy response file.
+var legacyEntryPattern = regexp.MustCompile(`^([a-z]+): (.*)$`)
+
+// LoadLegacyResponses loads a legacy "word: response" file written by an earlier run with model and prompt template.
+func (b *ReplayBackend) LoadLegacyResponses(path string, model string, template string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open response file (%s). %w", path, err)
+	}
+	defer f.Close()
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	count := 0
+	err = ScanLegacyResponses(f, nil, func(word string, response string) {
+		b.legacy[legacyKey{model: model, template: template, subject: word}] = response
+		count++
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read response file (%s). %w", path, err)
+	}
+
+	getLogger().Infof("loaded legacy responses (%d) from (%s) for model (%s), prompt (%s)", count, path, model, template)
+	return nil
+}
+
+// ScanLegacyResponses calls fn for every entry of a legacy "word: response" file, joining continuation lines.
+func ScanLegacyResponses(r io.Reader, isWord func(word string) bool, fn func(word string, response string)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	word := ""
+	var response strings.Builder
+	flush := func() {
+		if word != "" {
+			fn(word, strings.TrimRight(response.String(), "\n"))
+		}
+		response.Reset()
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		match := legacyEntryPattern.FindStringSubmatch(line)
+		if match != nil && isWord == nil {
+			// the first entry sets the word length
+			length := len(match[1])
+			isWord = func(word string) bool { return len(word) == length }
+		}
+		if match != nil && isWord(match[1]) {
+			flush()
+			word = match[1]
+			response.WriteString(match[2])
+			continue
+		}
+
+		if word != "" {
+			response.WriteString("\n" + line)
+		}
+	}
+	flush()
+
+	return scanner.Err()
+}
+
+// LoadCassette loads the interactions recorded in a cassette file.  A missing cassette is not an error.
+func (b *ReplayBackend) LoadCassette(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("failed to open cassette (%s). %w", path, err)
+	}
+	defer f.Close()
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	count := 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var interaction Interaction
+		if err := json.Unmarshal(scanner.Bytes(), &interaction); err != nil {
+			getLogger().Warnf("skipping invalid cassette line in (%s).  (%s)", path, err)
+			continue
+		}
+		b.recorded[interactionKey{model: interaction.Model, prompt: interaction.Prompt, subject: interaction.Subject}] = interaction.Response
+		count++
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read cassette (%s). %w", path, err)
+	}
+
+	getLogger().Infof("loaded recorded interactions (%d) from cassette (%s)", count, path)
+	return nil
+}
+
+// RecordTo sends misses to recorder and appends the new interactions to the cassette at path.
+func (b *ReplayBackend) RecordTo(recorder Backend, path string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open cassette (%s) for recording. %w", path, err)
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.recorder = recorder
+	b.cassette = f
+	return nil
+}
+
+func (b *ReplayBackend) Close() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	getLogger().Infof("replay backend, hits (%d), misses (%d), recorded (%d)", b.hits, b.misses, b.recordCount)
+	if b.cassette != nil {
+		if err := b.cassette.Close(); err != nil {
+			getLogger().Warnf("failed to close cassette (%s).  (%s)", b.cassette.Name(), err)
+		}
+		b.cassette = nil
+	}
+}
+
+func (b *ReplayBackend) lookup(request GenerateRequest) (string, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	response, found := b.recorded[interactionKey{model: request.Model, prompt: request.Prompt, subject: request.Subject}]
+	if !found && isLegacyRequest(request) {
+		response, found = b.legacy[legacyKey{model: request.Model, template: request.Template, subject: request.Subject}]
+	}
+
+	if found {
+		b.hits++
+	} else {
+		b.misses++
+	}
+	return response, found
+}
+
+// isLegacyRequest is true for a free text request without a system prompt, the only kind the legacy files answered.
+func isLegacyRequest(request GenerateRequest) bool {
+	return len(request.Format) == 0 && request.System == ""
+}
+
+func (b *ReplayBackend) record(request GenerateRequest, response string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.recorded[interactionKey{model: request.Model, prompt: request.Prompt, subject: request.Subject}] = response
+	if b.cassette == nil {
+		return nil
+	}
+
+	line, err := json.Marshal(Interaction{Model: request.Model, Prompt: request.Prompt, Subject: request.Subject, Response: response, RecordedAt: time.Now()})
+	if err != nil {
+		return fmt.Errorf("failed to marshal interaction. %w", err)
+	}
+	if _, err := b.cassette.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write interaction to cassette (%s). %w", b.cassette.Name(), err)
+	}
+	b.recordCount++
+	return nil
+}
+
+func (b *ReplayBackend) Generate(ctx context.Context, request GenerateRequest) (GenerateResponse, error) {
+	if response, found := b.lookup(request); found {
+		return GenerateResponse{Model: request.Model, Response: response}, nil
+	}
+
+	b.mutex.RLock()
+	recorder := b.recorder
+	b.mutex.RUnlock()
+	if recorder == nil {
+		return GenerateResponse{Model: request.Model}, fmt.Errorf("model (%s), subject (%s). %w", request.Model, request.Subject, ErrNotRecorded)
+	}
+
+	response, err := recorder.Generate(ctx, request)
+	if err != nil {
+		return response, err
+	}
+
+	if err := b.record(request, response.Response); err != nil {
+		getLogger().Warnf("failed to record interaction for subject (%s).  (%s)", request.Subject, err)
+	}
+	return response, nil
+}
+
+func (b *ReplayBackend) Chat(ctx context.Context, request ChatRequest) (ChatResponse, error) {
+	return chatWithGenerate(ctx, b, request)
+}
+
+func (b *ReplayBackend) Classify(ctx context.Context, request ClassifyRequest) (ClassifyResponse, error) {
+	return classifyWithGenerate(ctx, b, request)
+}
+
+func (b *ReplayBackend) Embed(ctx context.Context, request EmbedRequest) (EmbedResponse, error) {
+	b.mutex.RLock()
+	recorder := b.recorder
+	b.mutex.RUnlock()
+	if recorder == nil {
+		return EmbedResponse{}, fmt.Errorf("replay backend does not record embeddings. %w", ErrNotRecorded)
+	}
+	return recorder.Embed(ctx, request)
+}
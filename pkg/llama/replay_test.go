@@ -0,0 +1,220 @@
+package llama
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "re-record the testdata http cassette from a stand-in ollama server")
+
+const testPrompt = "is \"abbey\" an obscure english word?"
+
+func generate(t *testing.T, backend Backend, model string, prompt string, subject string) (string, error) {
+	t.Helper()
+	response, err := backend.Generate(context.Background(), GenerateRequest{Model: model, Prompt: prompt, Subject: subject})
+	return response.Response, err
+}
+
+func TestReplayCassette(t *testing.T) {
+	backend := NewReplayBackend()
+	if err := backend.LoadCassette("testdata/replay.cassette.jsonl"); err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+
+	for _, c := range []struct {
+		model    string
+		expected string
+	}{
+		{"llama3.2", "False. An abbey is a familiar word for a monastery."},
+		{"qwen2.5", "False."},
+	} {
+		response, err := generate(t, backend, c.model, testPrompt, "abbey")
+		if err != nil || response != c.expected {
+			t.Errorf("model (%s) replayed (%s, %v), expected (%s)", c.model, response, err, c.expected)
+		}
+	}
+
+	// the prompt is part of the key, a changed prompt is a miss
+	for _, request := range [][3]string{
+		{"llama3.2", "is \"abbey\" a rare english word?", "abbey"},
+		{"mistral", testPrompt, "abbey"},
+		{"llama3.2", "is \"cable\" an obscure english word?", "cable"},
+	} {
+		if _, err := generate(t, backend, request[0], request[1], request[2]); !errors.Is(err, ErrNotRecorded) {
+			t.Errorf("request (%v) returned (%v), expected not recorded", request, err)
+		}
+	}
+}
+
+func TestReplayMissingCassette(t *testing.T) {
+	backend := NewReplayBackend()
+	if err := backend.LoadCassette(filepath.Join(t.TempDir(), "missing.jsonl")); err != nil {
+		t.Errorf("missing cassette failed to load. %s", err)
+	}
+	if _, err := generate(t, backend, "llama3.2", testPrompt, "abbey"); !errors.Is(err, ErrNotRecorded) {
+		t.Errorf("empty replay returned (%v), expected not recorded", err)
+	}
+}
+
+func TestReplayLegacyResponses(t *testing.T) {
+	backend := NewReplayBackend()
+	if err := backend.LoadLegacyResponses("testdata/legacy.response.txt", "llama3.2", "obscure-v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	legacy := func(model string, subject string) GenerateRequest {
+		return GenerateRequest{Model: model, Prompt: "any prompt", Subject: subject, Template: "obscure-v1"}
+	}
+
+	// legacy entries match any prompt text of the version, the "note:" line is part of aahed's response
+	for word, expected := range map[string]string{
+		"abbey": "False. An abbey is a common word.",
+		"aahed": "True. It is an uncommon word.\n\nIt is the past tense of aah.\nnote: aah is an interjection.",
+		"cable": "False.",
+	} {
+		response, err := backend.Generate(context.Background(), legacy("llama3.2", word))
+		if err != nil || response.Response != expected {
+			t.Errorf("word (%s) replayed (%q, %v), expected (%q)", word, response.Response, err, expected)
+		}
+	}
+
+	// the legacy files answered the free text prompt only
+	jsonRequest := legacy("llama3.2", "abbey")
+	jsonRequest.Format = json.RawMessage(`"json"`)
+	systemRequest := legacy("llama3.2", "abbey")
+	systemRequest.System = "You curate the answer list."
+	otherPrompt := legacy("llama3.2", "abbey")
+	otherPrompt.Template = "obscure-json-v2"
+	for name, request := range map[string]GenerateRequest{
+		"other model":   legacy("qwen2.5", "abbey"),
+		"json format":   jsonRequest,
+		"system prompt": systemRequest,
+		"other prompt":  otherPrompt,
+	} {
+		if _, err := backend.Generate(context.Background(), request); !errors.Is(err, ErrNotRecorded) {
+			t.Errorf("%s returned (%v), expected not recorded", name, err)
+		}
+	}
+}
+
+func TestReplayRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.jsonl")
+	requests := 0
+	recorder := NewFakeBackend(func(request GenerateRequest) string {
+		requests++
+		return "True. Recorded."
+	})
+
+	backend := NewReplayBackend()
+	if err := backend.RecordTo(recorder, path); err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		if response, err := generate(t, backend, "llama3.2", testPrompt, "abbey"); err != nil || response != "True. Recorded." {
+			t.Errorf("recording replay returned (%s, %v)", response, err)
+		}
+	}
+	backend.Close()
+	if requests != 1 {
+		t.Errorf("recorder asked (%d) times, expected once", requests)
+	}
+
+	replay := NewReplayBackend()
+	if err := replay.LoadCassette(path); err != nil {
+		t.Fatal(err)
+	}
+	if response, err := generate(t, replay, "llama3.2", testPrompt, "abbey"); err != nil || response != "True. Recorded." {
+		t.Errorf("recorded cassette replayed (%s, %v)", response, err)
+	}
+}
+
+// ollamaStandIn answers /api/generate like an ollama server, with a response derived from the prompt.
+func ollamaStandIn(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Model  string `json:"model"`
+			Prompt string `json:"prompt"`
+		}
+		if r.URL.Path != "/api/generate" || json.NewDecoder(r.Body).Decode(&request) != nil {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"model":      request.Model,
+			"created_at": time.Date(2025, 1, 12, 10, 4, 31, 0, time.UTC),
+			"response":   "False. Answered (" + request.Prompt + ").",
+			"done":       true,
+			"eval_count": 7,
+		})
+	}))
+}
+
+func httpCassetteBackend(t *testing.T, url string, path string, mode string) Backend {
+	t.Helper()
+	config := DefaultBackendConfig()
+	config.URL = url
+	config.Timeout = 5 * time.Second
+	config.HTTPCassette = path
+	config.HTTPCassetteMode = mode
+	backend, err := NewBackend(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return backend
+}
+
+func TestHTTPCassetteReplay(t *testing.T) {
+	const path = "testdata/ollama.cassette.jsonl"
+	if *update {
+		server := ollamaStandIn(t)
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			t.Fatal(err)
+		}
+		recorder := httpCassetteBackend(t, server.URL, path, CassetteRecord)
+		if _, err := generate(t, recorder, "llama3.2", testPrompt, "abbey"); err != nil {
+			t.Fatal(err)
+		}
+		CloseBackend(recorder)
+		server.Close()
+	}
+
+	// nothing listens on the url, every answer comes from the cassette
+	backend := httpCassetteBackend(t, "http://127.0.0.1:1", path, CassetteReplay)
+	defer CloseBackend(backend)
+
+	response, err := generate(t, backend, "llama3.2", testPrompt, "abbey")
+	if expected := "False. Answered (" + testPrompt + ")."; err != nil || response != expected {
+		t.Errorf("cassette replayed (%s, %v), expected (%s)", response, err, expected)
+	}
+	if _, err := generate(t, backend, "llama3.2", "is \"cable\" an obscure english word?", "cable"); !errors.Is(err, ErrNotRecorded) {
+		t.Errorf("unrecorded request returned (%v), expected not recorded", err)
+	}
+}
+
+func TestHTTPCassetteRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ollama.cassette.jsonl")
+	server := ollamaStandIn(t)
+
+	recorder := httpCassetteBackend(t, server.URL, path, CassetteRecord)
+	recorded, err := generate(t, recorder, "llama3.2", testPrompt, "abbey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	CloseBackend(recorder)
+	server.Close()
+
+	backend := httpCassetteBackend(t, server.URL, path, CassetteReplay)
+	defer CloseBackend(backend)
+	if response, err := generate(t, backend, "llama3.2", testPrompt, "abbey"); err != nil || response != recorded {
+		t.Errorf("recorded exchange replayed (%s, %v), expected (%s)", response, err, recorded)
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"time"
 )
 
+const defaultOllamaUrl = "http://localhost:11434"
+
 func CreateSimpleClient() (*ollama.Client, error) {
 	client, err := ollama.ClientFromEnvironment()
 	if err != nil {
@@ -18,21 +20,37 @@ func CreateSimpleClient() (*ollama.Client, error) {
 }
 
 func CreateClient() (*ollama.Client, error) {
-	t := http.DefaultTransport.(*http.Transport).Clone()
-	t.MaxIdleConns = 100
-	t.MaxConnsPerHost = 100
-	t.MaxIdleConnsPerHost = 100
+	return CreateClientForUrl(defaultOllamaUrl, 60*time.Second)
+}
 
-	httpClient := &http.Client{
-		Transport: t,
-		Timeout:   60 * time.Second,
-	}
+func CreateClientForUrl(rawUrl string, timeout time.Duration) (*ollama.Client, error) {
+	return CreateClientWithTransport(rawUrl, timeout, nil)
+}
 
-	llamaUrl, err := url.Parse("http://localhost:11434")
+// CreateClientWithTransport creates a client whose http transport is wrapped, for example by a CassetteTransport.
+func CreateClientWithTransport(rawUrl string, timeout time.Duration, wrap func(http.RoundTripper) http.RoundTripper) (*ollama.Client, error) {
+	llamaUrl, err := url.Parse(rawUrl)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse url (%s)", err)
 	}
 
+	httpClient := newHttpClient(timeout)
+	if wrap != nil {
+		httpClient.Transport = wrap(httpClient.Transport)
+	}
+
 	client := ollama.NewClient(llamaUrl, httpClient)
 	return client, nil
 }
+
+func newHttpClient(timeout time.Duration) *http.Client {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConns = 100
+	t.MaxConnsPerHost = 100
+	t.MaxIdleConnsPerHost = 100
+
+	return &http.Client{
+		Transport: t,
+		Timeout:   timeout,
+	}
+}
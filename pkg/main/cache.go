@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go.uber.org/zap"
+	"ozzysoft.net/wordle/pkg/curate"
+	"ozzysoft.net/wordle/pkg/llama"
+	"ozzysoft.net/wordle/pkg/log"
+	"strings"
+)
+
+// runCache reports on or invalidates the response cache: cache stats [-config path] | clear [-config path] -model name | -all
+func runCache(args []string) int {
+	logger := log.Get().Sugar().Named("cache")
+
+	// the command comes first, so the flags after it are parsed
+	command := "stats"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+
+	fs := flag.NewFlagSet("cache", flag.ContinueOnError)
+	configPath := fs.String("config", curateConfigPath, "path of the curate config file")
+	model := fs.String("model", "", "clear only the entries for this model")
+	all := fs.Bool("all", false, "clear every entry")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 {
+		logger.Errorf("unexpected cache arguments (%s)", strings.Join(fs.Args(), " "))
+		return 2
+	}
+
+	config, err := curate.LoadConfig(*configPath)
+	if err != nil {
+		logger.With(zap.Error(err)).Errorf("failed to load curate config")
+		return 2
+	}
+	dir := config.Backend.Cache.Dir
+
+	switch command {
+	case "stats":
+		entries, size, err := llama.CacheStats(dir)
+		if err != nil {
+			logger.With(zap.Error(err)).Errorf("failed to read cache")
+			return 1
+		}
+		fmt.Printf("cache (%s), entries (%d), bytes (%d), max bytes (%d)\n", dir, entries, size, config.Backend.Cache.MaxBytes)
+	case "clear":
+		if (*model == "") == !*all {
+			logger.Errorf("cache clear needs either -model name or -all")
+			return 2
+		}
+		removed, err := llama.ClearCache(dir, *model)
+		if err != nil {
+			logger.With(zap.Error(err)).Errorf("failed to clear cache")
+			return 1
+		}
+		fmt.Printf("cache (%s), removed entries (%d)\n", dir, removed)
+	default:
+		logger.Errorf("unknown cache command (%s), expected stats or clear", command)
+		return 2
+	}
+
+	return 0
+}
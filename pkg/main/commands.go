@@ -0,0 +1,11 @@
+package main
+
+// commands are the subcommands, selected by the first argument.  Without one the curation run starts.
+var commands = map[string]func(args []string) int{
+	"cache":       runCache,
+	"consistency": runConsistency,
+	"diff":        runDiff,
+	"eval":        runEval,
+	"review":      runReview,
+	"sweep":       runSweep,
+}
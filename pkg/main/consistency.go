@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"go.uber.org/zap"
+	"os"
+	"os/signal"
+	"ozzysoft.net/wordle/pkg/curate"
+	"ozzysoft.net/wordle/pkg/llama"
+	"ozzysoft.net/wordle/pkg/log"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+)
+
+// runConsistency checks the explanations of the stored responses against their verdicts, reporting the contradiction
+// rate per prompt and model: consistency [-judge never|flagged|always] [-report path] [-requeue] [-limit n] [curate flags]
+func runConsistency(args []string) int {
+	logger := log.Get().Sugar().Named("consistency")
+
+	fs := flag.NewFlagSet("consistency", flag.ContinueOnError)
+	judge := fs.String("judge", "", "responses put to the judge model, never, flagged or always, overrides consistency.judge")
+	reportPath := fs.String("report", "", "report path, overrides consistency.reportPath")
+	requeue := fs.Bool("requeue", false, "journal the contradictory words as undetermined, so the next run asks about them again")
+	limit := fs.Int("limit", 20, "print at most this many contradictory words, 0 prints all of them")
+	config, err := parseCurateFlags(fs, args)
+	if err != nil {
+		logger.With(zap.Error(err)).Errorf("failed to load curate config")
+		return 2
+	}
+	if *judge != "" {
+		config.Consistency.Judge = curate.ConsistencyJudge(*judge)
+	}
+	if *reportPath != "" {
+		config.Consistency.ReportPath = *reportPath
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	var backend llama.Backend
+	if config.Consistency.Judge != curate.JudgeNever {
+		backend, err = llama.NewBackend(config.Backend)
+		if err != nil {
+			logger.With(zap.Error(err)).Errorf("failed to create backend")
+			return 1
+		}
+		defer llama.CloseBackend(backend)
+	}
+
+	report, err := curate.CheckConsistency(ctx, backend, config)
+	if err != nil {
+		logger.With(zap.Error(err)).Errorf("consistency check failed")
+		return 1
+	}
+	if err := curate.WriteConsistencyReport(config.Consistency.ReportPath, report); err != nil {
+		logger.With(zap.Error(err)).Errorf("failed to write consistency report")
+		return 1
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "prompt\tmodel\tresponses\tcontradictions\trate\tjudged\tjudge overruled")
+	for _, group := range report.Groups {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%.3f\t%d\t%d\n", group.Prompt, group.Model, group.Responses, group.Contradictions, group.Rate, group.Judged, group.JudgeOverruled)
+	}
+	fmt.Fprintf(w, "all\t\t%d\t%d\t%.3f\t\t\n", report.Responses, report.Contradictions, report.Rate)
+	w.Flush()
+	fmt.Println()
+
+	for i, check := range report.Contradictory {
+		if *limit > 0 && i >= *limit {
+			fmt.Printf("... contradictory words not shown (%d)\n", len(report.Contradictory)-i)
+			break
+		}
+		judged := ""
+		if check.Judge != "" {
+			judged = fmt.Sprintf(", judge (%s)", check.Judge)
+		}
+		fmt.Printf("%s: obscure (%t), decision (%s)%s\n", check.Word, check.Obscure, check.Decision, judged)
+		fmt.Printf("  for: %s\n  against: %s\n", strings.Join(check.Supporting, ", "), strings.Join(check.Opposing, ", "))
+		fmt.Printf("  response: %s\n", indentResponse(check.Response))
+	}
+	fmt.Printf("report (%s)\n", config.Consistency.ReportPath)
+
+	if *requeue && len(report.Contradictory) > 0 {
+		words := make([]string, 0, len(report.Contradictory))
+		for _, check := range report.Contradictory {
+			words = append(words, check.Word)
+		}
+		if err := curate.RequeueWords(config, words); err != nil {
+			logger.With(zap.Error(err)).Errorf("failed to requeue words")
+			return 1
+		}
+		fmt.Printf("requeued words (%d) in (%s), the next run asks about them again\n", len(words), config.JournalPath)
+	}
+
+	return 0
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go.uber.org/zap"
+	"os"
+	"ozzysoft.net/wordle/pkg/curate"
+	"ozzysoft.net/wordle/pkg/log"
+	"strings"
+	"text/tabwriter"
+)
+
+// runDiff compares two curation runs, each a run id, a run dir, a results file, a run manifest or a directory of legacy
+// response files: diff [-limit n] [curate flags] from to
+func runDiff(args []string) int {
+	logger := log.Get().Sugar().Named("diff")
+
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	limit := fs.Int("limit", 0, "print at most this many flips, 0 prints all of them")
+	config, err := parseCurateFlags(fs, args)
+	if err != nil {
+		logger.With(zap.Error(err)).Errorf("failed to load curate config")
+		return 2
+	}
+	if fs.NArg() != 2 {
+		logger.Errorf("diff needs two runs, found (%d)", fs.NArg())
+		return 2
+	}
+	fromPath, toPath := curate.ResolveRun(config.RunsDir, fs.Arg(0)), curate.ResolveRun(config.RunsDir, fs.Arg(1))
+
+	from, err := curate.LoadRun(fromPath)
+	if err != nil {
+		logger.With(zap.Error(err)).Errorf("failed to load run")
+		return 1
+	}
+	to, err := curate.LoadRun(toPath)
+	if err != nil {
+		logger.With(zap.Error(err)).Errorf("failed to load run")
+		return 1
+	}
+
+	fmt.Printf("from (%s), words (%d)\nto (%s), words (%d)\n\n", fromPath, len(from), toPath, len(to))
+	fromManifest, fromFound := curate.RunManifestPath(fromPath)
+	toManifest, toFound := curate.RunManifestPath(toPath)
+	if fromFound && toFound {
+		if err := printManifestChanges(fromManifest, toManifest); err != nil {
+			logger.With(zap.Error(err)).Errorf("failed to compare manifests")
+			return 1
+		}
+	}
+
+	diff := curate.DiffRuns(from, to)
+	fmt.Printf("common (%d), unchanged (%d), keep -> exclude (%d), exclude -> keep (%d), to undetermined (%d), from undetermined (%d), other changes (%d), only in from (%d), only in to (%d)\n\n",
+		diff.Common, diff.Unchanged, diff.KeepToExclude, diff.ExcludeToKeep, diff.ToUndetermined, diff.FromUndetermined, diff.OtherChanges, diff.OnlyFrom, diff.OnlyTo)
+
+	if len(diff.Reasons) > 0 {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "reason\tkeep -> exclude\texclude -> keep")
+		for _, reason := range diff.Reasons {
+			fmt.Fprintf(w, "%s\t%d\t%d\n", reason.Reason, reason.KeepToExclude, reason.ExcludeToKeep)
+		}
+		w.Flush()
+		fmt.Println()
+	}
+
+	for i, flip := range diff.Flips {
+		if *limit > 0 && i >= *limit {
+			fmt.Printf("... flips not shown (%d)\n", len(diff.Flips)-i)
+			break
+		}
+		fmt.Printf("%s: %s -> %s [%s]\n", flip.Word, flip.From, flip.To, strings.Join(flip.Reasons, ", "))
+		fmt.Printf("  from: %s\n", indentResponse(flip.FromResponse))
+		fmt.Printf("  to: %s\n", indentResponse(flip.ToResponse))
+	}
+
+	return 0
+}
+
+// printManifestChanges prints the settings that differ between two run manifests.
+func printManifestChanges(fromPath string, toPath string) error {
+	from, err := curate.LoadRunManifest(fromPath)
+	if err != nil {
+		return err
+	}
+	to, err := curate.LoadRunManifest(toPath)
+	if err != nil {
+		return err
+	}
+
+	rows := [][3]string{
+		{"models", manifestModels(from), manifestModels(to)},
+		{"model digest", from.ModelDigest, to.ModelDigest},
+		{"prompt", from.PromptVersion, to.PromptVersion},
+		{"format", string(from.Format), string(to.Format)},
+		{"batch size", fmt.Sprint(max(from.BatchSize, 1)), fmt.Sprint(max(to.BatchSize, 1))},
+		{"options", fmt.Sprint(from.Options), fmt.Sprint(to.Options)},
+		{"input hash", from.InputHash, to.InputHash},
+		{"git revision", from.GitRevision, to.GitRevision},
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "setting\tfrom\tto")
+	for _, row := range rows {
+		if row[1] != row[2] {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", row[0], row[1], row[2])
+		}
+	}
+	w.Flush()
+	fmt.Println()
+	return nil
+}
+
+// manifestModels lists the models of a run, older manifests only record the one.
+func manifestModels(manifest curate.RunManifest) string {
+	if len(manifest.Models) == 0 {
+		return manifest.Model
+	}
+	return strings.Join(manifest.Models, ", ")
+}
+
+// indentResponse puts the continuation lines of a multi line response under its first line.
+func indentResponse(response string) string {
+	return strings.ReplaceAll(strings.TrimSpace(response), "\n", "\n    ")
+}
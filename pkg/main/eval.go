@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"go.uber.org/zap"
+	"os"
+	"os/signal"
+	"ozzysoft.net/wordle/pkg/curate"
+	"ozzysoft.net/wordle/pkg/llama"
+	"ozzysoft.net/wordle/pkg/log"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+// runEval scores a prompt and model against a labeled gold set, or ranks earlier reports:
+// eval -gold path [-report path] [-name name] [curate flags] | eval compare report...
+func runEval(args []string) int {
+	logger := log.Get().Sugar().Named("eval")
+
+	if len(args) > 0 && args[0] == "compare" {
+		return compareEvalReports(args[1:])
+	}
+
+	fs := flag.NewFlagSet("eval", flag.ContinueOnError)
+	goldPath := fs.String("gold", "data/gold.csv", "labeled gold set, csv (word,decision) or jsonl")
+	reportPath := fs.String("report", "", "report path, defaults to data/eval/<prompt version>-<model>-batch<size>-<time>.json")
+	name := fs.String("name", "", "name of the configuration in the report")
+	config, err := parseCurateFlags(fs, args)
+	if err != nil {
+		logger.With(zap.Error(err)).Errorf("failed to load curate config")
+		return 2
+	}
+
+	gold, err := curate.LoadGoldSet(*goldPath)
+	if err != nil {
+		logger.With(zap.Error(err)).Errorf("failed to load gold set")
+		return 2
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	backend, err := llama.NewBackend(config.Backend)
+	if err != nil {
+		logger.With(zap.Error(err)).Errorf("failed to create backend")
+		return 1
+	}
+	defer llama.CloseBackend(backend)
+
+	report, err := curate.Evaluate(ctx, backend, config, gold)
+	if err != nil {
+		logger.With(zap.Error(err)).Errorf("evaluation failed")
+		return 1
+	}
+	report.GoldPath = *goldPath
+	if *name != "" {
+		report.Name = *name
+	}
+
+	if *reportPath == "" {
+		file := fmt.Sprintf("%s-%s-batch%d-%s.json", report.PromptVersion, report.Model, report.BatchSize, report.Timestamp.Format("20060102T150405"))
+		*reportPath = filepath.Join("data", "eval", strings.NewReplacer("/", "_", ":", "_").Replace(file))
+	}
+	if err := curate.WriteEvalReport(*reportPath, report); err != nil {
+		logger.With(zap.Error(err)).Errorf("failed to write eval report")
+		return 1
+	}
+
+	printEvalReports([]curate.EvalReport{report})
+	printConfusion(report)
+	if report.Interrupted {
+		fmt.Printf("interrupted, scored words (%d) of (%d)\n", report.Words, len(gold))
+	}
+	fmt.Printf("report (%s)\n", *reportPath)
+	return 0
+}
+
+// compareEvalReports prints the reports side by side, best first.
+func compareEvalReports(paths []string) int {
+	logger := log.Get().Sugar().Named("eval")
+	if len(paths) == 0 {
+		logger.Errorf("eval compare needs at least one report")
+		return 2
+	}
+
+	reports := make([]curate.EvalReport, 0, len(paths))
+	for _, path := range paths {
+		report, err := curate.LoadEvalReport(path)
+		if err != nil {
+			logger.With(zap.Error(err)).Errorf("failed to load eval report")
+			return 1
+		}
+		reports = append(reports, report)
+	}
+
+	for _, report := range reports[1:] {
+		if report.GoldPath != reports[0].GoldPath || report.Words != reports[0].Words {
+			logger.Warnf("reports were scored on different gold sets, (%s) with words (%d) and (%s) with words (%d)",
+				reports[0].GoldPath, reports[0].Words, report.GoldPath, report.Words)
+		}
+	}
+
+	curate.RankEvalReports(reports)
+	printEvalReports(reports)
+	return 0
+}
+
+func printEvalReports(reports []curate.EvalReport) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "rank\tname\tprompt\tmodel\tbatch\twords\taccuracy\tprecision\trecall\tf1\tparse failures\tmean ms\tp95 ms\tgold")
+	for i, r := range reports {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%d\t%.3f\t%.3f\t%.3f\t%.3f\t%.3f\t%.0f\t%.0f\t%s\n",
+			i+1, r.Name, r.PromptVersion, r.Model, max(r.BatchSize, 1), r.Words, r.Accuracy, r.Precision, r.Recall, r.F1, r.ParseFailureRate, r.LatencyMeanMs, r.LatencyP95Ms, r.GoldPath)
+	}
+	w.Flush()
+}
+
+func printConfusion(report curate.EvalReport) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\nexpected \\ actual\tkeep\texclude\tundetermined")
+	for _, expected := range []curate.Decision{curate.DecisionKeep, curate.DecisionExclude} {
+		row := report.Confusion[expected]
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\n", expected, row[curate.DecisionKeep], row[curate.DecisionExclude], row[curate.DecisionUndetermined])
+	}
+	fmt.Fprintf(w, "elapsed (%s), errors (%d), misses (%d)\n", time.Duration(report.ElapsedMs*float64(time.Millisecond)).Round(time.Millisecond), report.Errors, len(report.Misses))
+	w.Flush()
+}
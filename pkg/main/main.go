@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"errors"
+	"flag"
 	"go.uber.org/zap"
 	"os"
 	"os/signal"
@@ -14,6 +15,7 @@ import (
 )
 
 const logConfigPath = "config/logging/logging.yaml"
+const curateConfigPath = "config/curate/curate.yaml"
 
 func init() {
 	log.SetFromFile(logConfigPath)
@@ -23,6 +25,18 @@ func main() {
 	logger := log.Get().Sugar().Named("main")
 	logger.Infof("running")
 
+	if len(os.Args) > 1 {
+		if command, found := commands[os.Args[1]]; found {
+			os.Exit(command(os.Args[2:]))
+		}
+	}
+
+	config, deadLetters, err := parseFlags()
+	if err != nil {
+		logger.With(zap.Error(err)).Errorf("failed to load curate config")
+		os.Exit(2)
+	}
+
 	ctx := log.WithCtx(context.Background(), logger.Desugar())
 	ctx, contextCancelFunc := context.WithCancel(ctx)
 
@@ -32,12 +46,19 @@ func main() {
 	signal.Notify(signalChannel, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
 	go cancelContextOnSignal(ctx, signalChannel, contextCancelFunc, logger)
 
-	client, err := llama.CreateClient()
+	backend, err := llama.NewBackend(config.Backend)
 	if err != nil {
+		logger.With(zap.Error(err)).Errorf("failed to create backend")
 		contextCancelFunc()
 	} else {
-		err := curate.Curate(ctx, client, "data/words_five.txt")
+		defer llama.CloseBackend(backend)
+		if deadLetters {
+			err = curate.ReprocessDeadLetters(ctx, backend, config)
+		} else {
+			err = curate.Curate(ctx, backend, config)
+		}
 		if err != nil {
+			logger.With(zap.Error(err)).Errorf("curation failed")
 		}
 		contextCancelFunc()
 	}
@@ -58,6 +79,61 @@ func main() {
 	logger.Infof("exiting")
 }
 
+// parseFlags loads the curate config file and applies the command line flags over it.
+func parseFlags() (curate.Config, bool, error) {
+	deadLetters := flag.Bool("dead-letters", false, "curate only the words in the dead letter file")
+	config, err := parseCurateFlags(flag.CommandLine, os.Args[1:])
+	return config, *deadLetters, err
+}
+
+// parseCurateFlags parses args with the curate flags bound to fs, loads the curate config file (-config) and applies the
+// flags given in args over it.
+func parseCurateFlags(fs *flag.FlagSet, args []string) (curate.Config, error) {
+	configPath := fs.String("config", curateConfigPath, "path of the curate config file")
+	defaults := curate.DefaultConfig()
+	bindCurateFlags(fs, &defaults)
+	if err := fs.Parse(args); err != nil {
+		return defaults, err
+	}
+
+	config, err := curate.LoadConfig(*configPath)
+	if err != nil {
+		return config, err
+	}
+
+	// flags given on the command line take precedence over the config file
+	overrides := flag.NewFlagSet("overrides", flag.ContinueOnError)
+	bindCurateFlags(overrides, &config)
+	fs.Visit(func(f *flag.Flag) {
+		if overrides.Lookup(f.Name) != nil && err == nil {
+			err = overrides.Set(f.Name, f.Value.String())
+		}
+	})
+
+	return config, err
+}
+
+func bindCurateFlags(fs *flag.FlagSet, config *curate.Config) {
+	fs.StringVar(&config.InputPath, "words", config.InputPath, "path of the word list to curate")
+	fs.BoolVar(&config.Fresh, "fresh", config.Fresh, "discard the curation journal and start a fresh run")
+	fs.BoolVar(&config.LegacyOutput, "legacy", config.LegacyOutput, "also write the curated/excluded text files")
+	fs.StringVar(&config.Backend.Kind, "backend", config.Backend.Kind, "model backend, ollama, openai, pool, replay or fake")
+	fs.StringVar(&config.Backend.URL, "backend-url", config.Backend.URL, "model backend base url")
+	fs.StringVar(&config.Determine.Prompt, "prompt", config.Determine.Prompt, "name of the prompt definition in the prompt dir, empty for the default prompt of the format")
+	fs.StringVar(&config.Determine.Model, "model", config.Determine.Model, "model asked about each word")
+	fs.StringVar((*string)(&config.Determine.Format), "format", string(config.Determine.Format), "model response format, json or text")
+	fs.Float64Var(&config.Determine.MinConfidence, "min-confidence", config.Determine.MinConfidence, "json verdicts below this confidence are left undetermined")
+	fs.BoolVar(&config.Determine.Verbose, "verbose", config.Determine.Verbose, "print every curated word")
+	fs.BoolVar(&config.Determine.EarlyExit, "early-exit", config.Determine.EarlyExit, "stream answers and stop at the verdict, dropping the explanation")
+	fs.IntVar(&config.Determine.MaxTokens, "max-tokens", config.Determine.MaxTokens, "cap on answer tokens (num_predict), 0 leaves it to the model")
+	fs.IntVar(&config.Batch.Size, "batch-size", config.Batch.Size, "words per model request, 1 asks about one word at a time")
+	fs.IntVar(&config.MaxConcurrency, "concurrency", config.MaxConcurrency, "maximum words curated concurrently")
+	fs.BoolVar(&config.Concurrency.Adaptive, "adaptive", config.Concurrency.Adaptive, "adapt the concurrency limit to observed latency and errors")
+	fs.IntVar(&config.Retry.MaxAttempts, "max-attempts", config.Retry.MaxAttempts, "model call attempts per word before it is dead lettered")
+	fs.DurationVar(&config.Retry.WordTimeout, "word-timeout", config.Retry.WordTimeout, "deadline for all attempts on a single word")
+	fs.StringVar(&config.Ensemble.Policy, "policy", config.Ensemble.Policy, "ensemble aggregation policy, majority, unanimous or weighted")
+}
+
 func cancelContextOnSignal(ctx context.Context, channel chan os.Signal, cancelFunc context.CancelFunc, logger *zap.SugaredLogger) {
 	select {
 	case sig := <-channel:
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"go.uber.org/zap"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"ozzysoft.net/wordle/pkg/curate"
+	"ozzysoft.net/wordle/pkg/log"
+	"strings"
+	"syscall"
+)
+
+// reviewKeys maps the review keystrokes to decisions, skip is journaled as undetermined.
+var reviewKeys = map[byte]curate.Decision{
+	'a': curate.DecisionKeep,
+	'r': curate.DecisionExclude,
+	'g': curate.DecisionGuessOnly,
+	's': curate.DecisionUndetermined,
+	' ': curate.DecisionUndetermined,
+}
+
+// runReview walks a person through the undetermined, low confidence and contradictory words, one keystroke per word,
+// saving their decisions as overrides: review [-author name] [-review-confidence n] [-restart] [curate flags]
+func runReview(args []string) int {
+	logger := log.Get().Sugar().Named("review")
+
+	fs := flag.NewFlagSet("review", flag.ContinueOnError)
+	author := fs.String("author", os.Getenv("USER"), "author recorded with the overrides")
+	minConfidence := fs.Float64("review-confidence", -1, "review answers below this confidence, overrides review.minConfidence")
+	restart := fs.Bool("restart", false, "clear the review journal, showing skipped words again")
+	config, err := parseCurateFlags(fs, args)
+	if err != nil {
+		logger.With(zap.Error(err)).Errorf("failed to load curate config")
+		return 2
+	}
+	if *minConfidence >= 0 {
+		config.Review.MinConfidence = *minConfidence
+	}
+
+	if *restart {
+		if err := os.Remove(config.Review.JournalPath); err != nil && !os.IsNotExist(err) {
+			logger.With(zap.Error(err)).Errorf("failed to clear review journal")
+			return 1
+		}
+	}
+
+	queue, err := curate.LoadReviewQueue(config)
+	if err != nil {
+		logger.With(zap.Error(err)).Errorf("failed to load review queue")
+		return 1
+	}
+	if len(queue) == 0 {
+		fmt.Println("nothing to review")
+		return 0
+	}
+
+	journal, err := curate.OpenJournal(config.Review.JournalPath, false)
+	if err != nil {
+		logger.With(zap.Error(err)).Errorf("failed to open review journal")
+		return 1
+	}
+	defer journal.Close()
+
+	restore, err := cbreakTerminal()
+	if err != nil {
+		logger.Infof("not a terminal, reading one line per word.  (%s)", err)
+	} else {
+		defer restore()
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	keys := readKeys(os.Stdin, restore != nil)
+
+	decided := 0
+	for i, item := range queue {
+		printReviewItem(i, len(queue), decided, item)
+
+		var key byte
+		for {
+			select {
+			case <-ctx.Done():
+				fmt.Println()
+				return 130
+			case k, open := <-keys:
+				if !open {
+					fmt.Println()
+					return 0
+				}
+				key = k
+			}
+			if _, found := reviewKeys[key]; found || key == 'q' {
+				break
+			}
+		}
+
+		if key == 'q' {
+			fmt.Printf("quit, decided (%d), remaining (%d)\n", decided, len(queue)-i)
+			return 0
+		}
+
+		decision := reviewKeys[key]
+		if decision == curate.DecisionUndetermined {
+			fmt.Print("skipped\n\n")
+		} else {
+			override := curate.Override{Word: item.Word, Decision: decision, Reason: "review (" + item.Why + ")", Author: *author}
+			if err := curate.AppendOverride(config.Overrides, override); err != nil {
+				logger.With(zap.Error(err)).Errorf("failed to save override")
+				return 1
+			}
+			decided++
+			fmt.Printf("%s\n\n", decision)
+		}
+		if err := journal.RecordReview(item.Word, decision); err != nil {
+			logger.With(zap.Error(err)).Errorf("failed to record review")
+			return 1
+		}
+	}
+
+	fmt.Printf("review complete, decided (%d), words (%d)\n", decided, len(queue))
+	return 0
+}
+
+func printReviewItem(i int, total int, decided int, item curate.ReviewItem) {
+	fmt.Printf("[%d/%d, %d%%, decided %d] %s\n", i+1, total, 100*i/total, decided, item.Word)
+
+	status := fmt.Sprintf("  %s, now (%s)", item.Why, item.Decision)
+	if item.Confidence != nil {
+		status += fmt.Sprintf(", confidence (%.2f)", *item.Confidence)
+	}
+	fmt.Println(status)
+	if item.Definition != "" {
+		fmt.Printf("  definition: %s\n", item.Definition)
+	}
+	fmt.Printf("  response: %s\n", indentResponse(item.Response))
+	fmt.Print("[a]ccept  [r]eject  [g]uess only  [s]kip  [q]uit > ")
+}
+
+// readKeys sends each byte read from r, the channel is closed at the end of the input.
+func readKeys(r io.Reader, cbreak bool) <-chan byte {
+	keys := make(chan byte)
+	go func() {
+		defer close(keys)
+		reader := bufio.NewReader(r)
+		for {
+			b, err := reader.ReadByte()
+			if err != nil {
+				return
+			}
+			if b == '\n' || b == '\r' {
+				continue
+			}
+			keys <- b
+			if !cbreak {
+				// drop the rest of the line
+				if _, err := reader.ReadString('\n'); err != nil {
+					return
+				}
+			}
+		}
+	}()
+	return keys
+}
+
+// cbreakTerminal puts the terminal into cbreak mode, single keystrokes without echo, with stty.
+func cbreakTerminal() (func(), error) {
+	state, err := stty("-g")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := stty("cbreak", "-echo"); err != nil {
+		return nil, err
+	}
+
+	return func() {
+		if _, err := stty(state); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to restore the terminal, run stty sane.  (%s)\n", err)
+		}
+	}, nil
+}
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("stty %s failed. %w", strings.Join(args, " "), err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"go.uber.org/zap"
+	"os"
+	"os/signal"
+	"ozzysoft.net/wordle/pkg/curate"
+	"ozzysoft.net/wordle/pkg/llama"
+	"ozzysoft.net/wordle/pkg/log"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+)
+
+// runSweep runs the sweep grid and prints the per cell table:
+// sweep [-models a,b] [-prompts a,b] [-temperatures 0,0.7] [-seeds 1,2] [-batch-sizes 1,10] [-sample n] [-sweep-dir dir] [curate flags]
+func runSweep(args []string) int {
+	logger := log.Get().Sugar().Named("sweep")
+
+	fs := flag.NewFlagSet("sweep", flag.ContinueOnError)
+	models := fs.String("models", "", "comma separated models, overrides sweep.models")
+	prompts := fs.String("prompts", "", "comma separated prompt names, overrides sweep.prompts")
+	temperatures := fs.String("temperatures", "", "comma separated temperatures, overrides sweep.temperatures")
+	seeds := fs.String("seeds", "", "comma separated seeds, overrides sweep.seeds")
+	batchSizes := fs.String("batch-sizes", "", "comma separated batch sizes, 1 for single words, overrides sweep.batchSizes")
+	sample := fs.Int("sample", 0, "sample size, overrides sweep.sampleSize")
+	dir := fs.String("sweep-dir", "", "cell result dir, overrides sweep.dir")
+	config, err := parseCurateFlags(fs, args)
+	if err != nil {
+		logger.With(zap.Error(err)).Errorf("failed to load curate config")
+		return 2
+	}
+
+	if *models != "" {
+		config.Sweep.Models = splitList(*models)
+	}
+	if *prompts != "" {
+		config.Sweep.Prompts = splitList(*prompts)
+	}
+	if *temperatures != "" {
+		config.Sweep.Temperatures = nil
+		for _, s := range splitList(*temperatures) {
+			t, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				logger.Errorf("invalid temperature (%s)", s)
+				return 2
+			}
+			config.Sweep.Temperatures = append(config.Sweep.Temperatures, t)
+		}
+	}
+	if *seeds != "" {
+		config.Sweep.Seeds = nil
+		for _, s := range splitList(*seeds) {
+			seed, err := strconv.Atoi(s)
+			if err != nil {
+				logger.Errorf("invalid seed (%s)", s)
+				return 2
+			}
+			config.Sweep.Seeds = append(config.Sweep.Seeds, seed)
+		}
+	}
+	if *batchSizes != "" {
+		config.Sweep.BatchSizes = nil
+		for _, s := range splitList(*batchSizes) {
+			size, err := strconv.Atoi(s)
+			if err != nil || size < 1 {
+				logger.Errorf("invalid batch size (%s)", s)
+				return 2
+			}
+			config.Sweep.BatchSizes = append(config.Sweep.BatchSizes, size)
+		}
+	}
+	if *sample > 0 {
+		config.Sweep.SampleSize = *sample
+	}
+	if *dir != "" {
+		config.Sweep.Dir = *dir
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	backend, err := llama.NewBackend(config.Backend)
+	if err != nil {
+		logger.With(zap.Error(err)).Errorf("failed to create backend")
+		return 1
+	}
+	defer llama.CloseBackend(backend)
+
+	results, err := curate.Sweep(ctx, backend, config)
+	printSweepResults(results)
+	if err != nil {
+		logger.With(zap.Error(err)).Errorf("sweep stopped, rerun to resume from the next incomplete cell")
+		return 1
+	}
+	return 0
+}
+
+func splitList(s string) []string {
+	var values []string
+	for _, value := range strings.Split(s, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func printSweepResults(results []curate.SweepResult) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "model\tprompt\ttemperature\tseed\tbatch\tlabeled\tagreement\texclude precision\texclude recall\tparse failures\twords/s")
+	for _, r := range results {
+		temperature, seed := "-", "-"
+		if r.Cell.Temperature != nil {
+			temperature = strconv.FormatFloat(*r.Cell.Temperature, 'g', -1, 64)
+		}
+		if r.Cell.Seed != nil {
+			seed = strconv.Itoa(*r.Cell.Seed)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\t%.3f\t%.3f\t%.3f\t%.3f\t%.1f\n",
+			r.Report.Model, r.Report.PromptVersion, temperature, seed, max(r.Cell.BatchSize, 1), r.Labeled, r.Agreement, r.Report.Precision, r.Report.Recall, r.Report.ParseFailureRate, r.Throughput)
+	}
+	w.Flush()
+
+	for _, r := range results {
+		if len(r.Report.Misses) == 0 {
+			continue
+		}
+		fmt.Printf("\ndisagreements (%s)\n", r.Cell.ID())
+		for _, miss := range r.Report.Misses {
+			fmt.Printf("  %s: reference (%s), cell (%s) %s\n", miss.Word, miss.Expected, miss.Actual, strings.Join(strings.Fields(miss.Response), " "))
+		}
+	}
+}